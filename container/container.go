@@ -1,6 +1,8 @@
 package container
 
 import (
+	"io"
+
 	docker "github.com/fsouza/go-dockerclient"
 )
 
@@ -32,9 +34,10 @@ type Volume struct {
 type Config struct {
 	Image   string
 	Command []string
-	// Defaults to unlimited.
+	Env     map[string]string
+	// Bytes, defaults to unlimited.
 	Memory int
-	// Defaults to unlimited.
+	// Thousandths of a core, defaults to unlimited.
 	CPU     int
 	Ports   []Port
 	Volumes []Volume
@@ -52,6 +55,7 @@ type ContainerManager interface {
 	RemoveContainer(name string) error
 	RemoveImage(name string) error
 	InspectContainer(name string) (*docker.Container, error)
+	Logs(name string, stderr bool, tail int, w io.Writer) error
 }
 
 func Start(image, tag string, config *Config) error {
@@ -93,3 +97,9 @@ func RemoveContainer(name string) error {
 func ListContainers(all bool) ([]docker.APIContainers, error) {
 	return manager.ListContainers(all)
 }
+
+// Logs writes the last lines of the stdout, or stderr, of a container, or
+// all of it if tail is 0
+func Logs(name string, stderr bool, tail int, w io.Writer) error {
+	return manager.Logs(name, stderr, tail, w)
+}
@@ -2,10 +2,12 @@ package container
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 
 	log "github.com/cihub/seelog"
@@ -84,12 +86,23 @@ func (m *dockerManager) Start(image, tag string, conf *Config) error {
 	_, err := m.c.InspectContainer(name)
 	if err != nil {
 		log.Infof("Creating container %s", name)
+		dc := &docker.Config{
+			Env:   getEnv(),
+			Image: registryUrl + "/" + image + ":" + tag,
+		}
+		if conf != nil {
+			for k, v := range conf.Env {
+				dc.Env = append(dc.Env, k+"="+v)
+			}
+			dc.Cmd = conf.Command
+			dc.Memory = int64(conf.Memory)
+			// shares are relative to 1024 for a whole core
+			dc.CPUShares = int64(conf.CPU) * 1024 / 1000
+		}
+
 		_, err := m.c.CreateContainer(docker.CreateContainerOptions{
-			Name: name,
-			Config: &docker.Config{
-				Env:   getEnv(),
-				Image: registryUrl + "/" + image + ":" + tag,
-			},
+			Name:   name,
+			Config: dc,
 		})
 
 		if err != nil {
@@ -167,6 +180,22 @@ func (m *dockerManager) IsRunning(name string) bool {
 	return true
 }
 
+func (m *dockerManager) Logs(name string, stderr bool, tail int, w io.Writer) error {
+	lines := "all"
+	if tail > 0 {
+		lines = strconv.Itoa(tail)
+	}
+
+	return m.c.Logs(docker.LogsOptions{
+		Container:    name,
+		OutputStream: w,
+		ErrorStream:  w,
+		Stdout:       !stderr,
+		Stderr:       stderr,
+		Tail:         lines,
+	})
+}
+
 func (m *dockerManager) Stop(name string, timeout uint) error {
 
 	log.Infof("Stopping container %s", name)
@@ -1,21 +1,35 @@
 package dao
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"sync"
+	"time"
 
 	log "github.com/cihub/seelog"
 	"github.com/HailoOSS/platform/client"
 	"github.com/HailoOSS/platform/server"
 	"github.com/HailoOSS/protobuf/proto"
 	pproto "github.com/HailoOSS/provisioning-manager-service/proto/provisioned"
+	"github.com/HailoOSS/provisioning-service/fsutil"
 )
 
 const (
+	cacheFormatVersion = 1
+	// how often the cache is saved while the services don't change, so its
+	// fetch time shows they were still provisioned
+	cacheSaveInterval = 10 * time.Minute
+
+	sourceManager     = "provisioning-manager"
+	sourceLegacyCache = "legacy cache"
+)
+
+var (
 	cacheFile = "/opt/hailo/var/cache/provisioned.json"
 )
 
@@ -24,6 +38,35 @@ type loader struct {
 	initialised bool
 	hash        string
 	services    ProvisionedServices
+	fetched     time.Time
+	source      string
+	fromCache   bool
+	saved       time.Time
+}
+
+// cachedList is the provisioned services cache on disk. The checksum is the
+// sha256 of the services JSON.
+type cachedList struct {
+	Version  int
+	Fetched  time.Time
+	Source   string
+	Checksum string
+	Services json.RawMessage
+}
+
+// CacheState describes the provisioned services last loaded
+type CacheState struct {
+	// Fetched is when they were fetched from Source
+	Fetched time.Time
+	Source  string
+	// FromCache is set when provisioning manager couldn't be reached, and the
+	// services were last loaded from the cache
+	FromCache bool
+}
+
+// Age returns how long ago the services were fetched
+func (c *CacheState) Age() time.Duration {
+	return time.Since(c.Fetched)
 }
 
 var (
@@ -31,8 +74,10 @@ var (
 )
 
 func init() {
-	if services, err := defaultLoader.load(); err == nil {
-		defaultLoader.cache(services)
+	if services, fetched, source, err := defaultLoader.load(); err == nil {
+		defaultLoader.cache(services, fetched, source, true)
+	} else if !os.IsNotExist(err) {
+		log.Warnf("Error loading provisioned services cache: %v", err)
 	}
 }
 
@@ -51,14 +96,18 @@ func getProvisionedServices(machineClass string) (ProvisionedServices, error) {
 
 	var provisioned ProvisionedServices
 	for _, service := range response.GetServices() {
-		provisioned = append(provisioned, &ProvisionedService{
+		ps := &ProvisionedService{
 			ServiceName:     service.GetServiceName(),
 			ServiceVersion:  service.GetServiceVersion(),
 			MachineClass:    service.GetMachineClass(),
 			NoFileSoftLimit: service.GetNoFileSoftLimit(),
 			NoFileHardLimit: service.GetNoFileHardLimit(),
 			ServiceType:     ServiceType(service.GetServiceType()),
-		})
+			CPU:             service.GetCpu(),
+			Memory:          service.GetMemory(),
+		}
+		loadSettings(ps)
+		provisioned = append(provisioned, ps)
 	}
 	return provisioned, nil
 }
@@ -67,61 +116,139 @@ func newLoader() *loader {
 	return &loader{}
 }
 
-func (l *loader) load() (ProvisionedServices, error) {
+// load reads the cache, checking its version and checksum. Caches written
+// before they were versioned are a plain list, fetched when last modified.
+func (l *loader) load() (ProvisionedServices, time.Time, string, error) {
 	b, err := ioutil.ReadFile(cacheFile)
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, "", err
 	}
 
 	var services ProvisionedServices
-	err = json.Unmarshal(b, &services)
-	if err != nil {
-		return nil, err
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		fi, err := os.Stat(cacheFile)
+		if err != nil {
+			return nil, time.Time{}, "", err
+		}
+		if err := json.Unmarshal(b, &services); err != nil {
+			return nil, time.Time{}, "", err
+		}
+		return services, fi.ModTime(), sourceLegacyCache, nil
 	}
 
-	return services, nil
+	list := &cachedList{}
+	if err := json.Unmarshal(b, list); err != nil {
+		return nil, time.Time{}, "", fmt.Errorf("Corrupt cache %s: %v", cacheFile, err)
+	}
+	if list.Version != cacheFormatVersion {
+		return nil, time.Time{}, "", fmt.Errorf("Unknown cache version %d in %s", list.Version, cacheFile)
+	}
+	if sum := checksum(list.Services); sum != list.Checksum {
+		return nil, time.Time{}, "", fmt.Errorf("Corrupt cache %s: checksum %s, expected %s", cacheFile, sum, list.Checksum)
+	}
+	if err := json.Unmarshal(list.Services, &services); err != nil {
+		return nil, time.Time{}, "", fmt.Errorf("Corrupt cache %s: %v", cacheFile, err)
+	}
+
+	return services, list.Fetched, list.Source, nil
 }
 
 func (l *loader) save() error {
 	l.mtx.Lock()
 	defer l.mtx.Unlock()
 
-	b, err := json.Marshal(l.services)
+	services, err := json.Marshal(l.services)
 	if err != nil {
 		return err
 	}
 
-	dir := filepath.Dir(cacheFile)
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return err
-		}
+	b, err := json.Marshal(&cachedList{
+		Version:  cacheFormatVersion,
+		Fetched:  l.fetched,
+		Source:   l.source,
+		Checksum: checksum(services),
+		Services: services,
+	})
+	if err != nil {
+		return err
 	}
 
-	if err := ioutil.WriteFile(cacheFile, b, 0644); err != nil {
+	if err := fsutil.WriteFile(cacheFile, b, 0644); err != nil {
 		return err
 	}
 
+	l.saved = time.Now()
 	return nil
 }
 
-func (l *loader) cache(services ProvisionedServices) {
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// servicesChecksum returns the checksum of the services JSON, or nothing if
+// they can't be marshalled
+func servicesChecksum(services ProvisionedServices) string {
+	b, err := json.Marshal(services)
+	if err != nil {
+		return ""
+	}
+	return checksum(b)
+}
+
+func (l *loader) cache(services ProvisionedServices, fetched time.Time, source string, fromCache bool) {
 	l.mtx.Lock()
 	l.services = services
-	l.hash = fmt.Sprintf("%x", services)
+	l.hash = servicesChecksum(services)
 	l.initialised = true
+	l.fetched = fetched
+	l.source = source
+	l.fromCache = fromCache
 	l.mtx.Unlock()
 }
 
-func (l *loader) hasChanged(services ProvisionedServices) bool {
+// refetched records services being fetched from provisioning manager again,
+// returning whether the cache should be saved to show they still are
+func (l *loader) refetched() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.fetched = time.Now()
+	l.source = sourceManager
+	l.fromCache = false
+	return time.Since(l.saved) > cacheSaveInterval
+}
+
+// usingCache records falling back to the cache
+func (l *loader) usingCache() {
+	l.mtx.Lock()
+	l.fromCache = true
+	l.mtx.Unlock()
+}
+
+func (l *loader) state() *CacheState {
 	l.mtx.RLock()
 	defer l.mtx.RUnlock()
 
-	if hash := fmt.Sprintf("%x", services); l.hash != hash {
-		return true
+	if !l.initialised {
+		return nil
+	}
+
+	return &CacheState{
+		Fetched:   l.fetched,
+		Source:    l.source,
+		FromCache: l.fromCache,
 	}
+}
 
-	return false
+// hasChanged returns whether services differ from those cached, comparing
+// their contents rather than where they happen to be in memory
+func (l *loader) hasChanged(services ProvisionedServices) bool {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	hash := servicesChecksum(services)
+	return len(hash) == 0 || l.hash != hash
 }
 
 func (l *loader) getCachedServices(machineClass string) (ProvisionedServices, error) {
@@ -139,8 +266,13 @@ func (l *loader) getServices(machineClass string) (ProvisionedServices, error) {
 	// load from provisioning manager
 	services, err := getProvisionedServices(machineClass)
 	if err == nil {
+		save := true
 		if l.hasChanged(services) {
-			l.cache(services)
+			l.cache(services, time.Now(), sourceManager, false)
+		} else {
+			save = l.refetched()
+		}
+		if save {
 			if err := l.save(); err != nil {
 				log.Warnf("Error saving provisioned services to disk: %v", err)
 			}
@@ -153,13 +285,14 @@ func (l *loader) getServices(machineClass string) (ProvisionedServices, error) {
 	// load from cache
 	services, err = l.getCachedServices(machineClass)
 	if err == nil {
+		l.usingCache()
 		return services, nil
 	}
 
 	// load from disk
-	services, err = l.load()
+	services, fetched, source, err := l.load()
 	if err == nil {
-		l.cache(services)
+		l.cache(services, fetched, source, true)
 		return services, nil
 	}
 
@@ -167,9 +300,23 @@ func (l *loader) getServices(machineClass string) (ProvisionedServices, error) {
 }
 
 func CachedServices(machineClass string) (ProvisionedServices, error) {
-	return defaultLoader.getCachedServices(machineClass)
+	services, err := defaultLoader.getCachedServices(machineClass)
+	if err != nil {
+		return nil, err
+	}
+	return peekOverrides(services, machineClass), nil
+}
+
+// Cache describes the provisioned services last loaded, or nil if none have
+// been
+func Cache() *CacheState {
+	return defaultLoader.state()
 }
 
 func Services(machineClass string) (ProvisionedServices, error) {
-	return defaultLoader.getServices(machineClass)
+	services, err := defaultLoader.getServices(machineClass)
+	if err != nil {
+		return nil, err
+	}
+	return withOverrides(services, machineClass), nil
 }
@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(f string) { cacheFile = f }(cacheFile)
+	cacheFile = filepath.Join(dir, "cache", "provisioned.json")
+
+	fetched := time.Now().Add(-time.Hour).Round(time.Second)
+	l := newLoader()
+	l.cache(ProvisionedServices{{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 1}}, fetched, sourceManager, false)
+	if err := l.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	services, when, source, err := l.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || !when.Equal(fetched) || source != sourceManager {
+		t.Errorf("Expected the cache to be read back, got %v fetched %v from %s", services, when, source)
+	}
+
+	if files, _ := ioutil.ReadDir(filepath.Dir(cacheFile)); len(files) != 1 {
+		t.Errorf("Expected only the cache file to be left, got %d files", len(files))
+	}
+
+	b, _ := ioutil.ReadFile(cacheFile)
+	ioutil.WriteFile(cacheFile, bytes.Replace(b, []byte("service.foo"), []byte("service.fop"), 1), 0644)
+	if _, _, _, err := l.load(); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Expected a changed cache to fail its checksum, got %v", err)
+	}
+
+	ioutil.WriteFile(cacheFile, []byte(`[{"ServiceName": "com.HailoOSS.service.bar", "ServiceVersion": 2}]`), 0644)
+	services, _, source, err = l.load()
+	if err != nil || len(services) != 1 || source != sourceLegacyCache {
+		t.Errorf("Expected the legacy cache to be read, got %v from %s: %v", services, source, err)
+	}
+}
+
+func TestHasChanged(t *testing.T) {
+	services := func() ProvisionedServices {
+		return ProvisionedServices{{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 1}}
+	}
+
+	l := newLoader()
+	if !l.hasChanged(services()) {
+		t.Error("Expected services to have changed from none")
+	}
+
+	l.cache(services(), time.Now(), sourceManager, false)
+	if l.hasChanged(services()) {
+		t.Error("Expected the same services fetched again not to have changed")
+	}
+
+	changed := services()
+	changed[0].ServiceVersion = 2
+	if !l.hasChanged(changed) {
+		t.Error("Expected a new version to have changed")
+	}
+}
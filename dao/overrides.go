@@ -0,0 +1,257 @@
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/event"
+)
+
+const (
+	defaultOverridesFile = "/opt/hailo/etc/provisioning-overrides.json"
+
+	// OverridePin keeps a service at a version
+	OverridePin = "pin"
+	// OverrideExclude keeps a service off this host
+	OverrideExclude = "exclude"
+	// OverrideAdd runs a service which isn't provisioned
+	OverrideAdd = "add"
+)
+
+var (
+	overridesFile = defaultOverridesFile
+
+	overridesMtx sync.Mutex
+	// active overrides when they were last applied, by description
+	lastOverrides = make(map[string]*Override)
+)
+
+func init() {
+	if f := os.Getenv("H2O_OVERRIDES_FILE"); f != "" {
+		overridesFile = f
+	}
+}
+
+// Override changes what should run on this host, whatever provisioning
+// manager says
+type Override struct {
+	Type           string `json:"-"`
+	ServiceName    string
+	ServiceVersion uint64      `json:",omitempty"` // for exclude, only this version; 0 is any
+	ServiceType    ServiceType `json:",omitempty"` // for add
+	Expires        time.Time   // never if zero
+	Reason         string      `json:",omitempty"`
+}
+
+// overrides is the layout of the overrides file
+type overrides struct {
+	Pin     []*Override `json:",omitempty"`
+	Exclude []*Override `json:",omitempty"`
+	Add     []*Override `json:",omitempty"`
+}
+
+func (o *Override) String() string {
+	desc := fmt.Sprintf("%s %s", o.Type, o.ServiceName)
+	if o.ServiceVersion > 0 {
+		desc += fmt.Sprintf("-%d", o.ServiceVersion)
+	}
+	if !o.Expires.IsZero() {
+		desc += fmt.Sprintf(" until %s", o.Expires.Format(time.RFC3339))
+	}
+	if o.Reason != "" {
+		desc += ": " + o.Reason
+	}
+	return desc
+}
+
+func (o *Override) expired(now time.Time) bool {
+	return !o.Expires.IsZero() && !now.Before(o.Expires)
+}
+
+// readOverrides returns the overrides in the overrides file which haven't
+// expired
+func readOverrides(now time.Time) ([]*Override, error) {
+	b, err := ioutil.ReadFile(overridesFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var o overrides
+	if err := json.Unmarshal(b, &o); err != nil {
+		return nil, fmt.Errorf("Invalid overrides file %s: %v", overridesFile, err)
+	}
+
+	var active []*Override
+	for typ, list := range map[string][]*Override{OverridePin: o.Pin, OverrideExclude: o.Exclude, OverrideAdd: o.Add} {
+		for _, override := range list {
+			override.Type = typ
+			if len(override.ServiceName) == 0 {
+				log.Warnf("Ignoring %s override without a service name", typ)
+				continue
+			}
+			if typ != OverrideExclude && override.ServiceVersion == 0 {
+				log.Warnf("Ignoring %s override of %s without a version", typ, override.ServiceName)
+				continue
+			}
+			if !override.expired(now) {
+				active = append(active, override)
+			}
+		}
+	}
+
+	return active, nil
+}
+
+// applyOverrides returns the services which should run once overrides are
+// applied, without changing the services passed in. Exclusions win over
+// pins and additions, and pins only apply to provisioned services.
+func applyOverrides(services ProvisionedServices, active []*Override, machineClass string) ProvisionedServices {
+	if len(active) == 0 {
+		return services
+	}
+
+	pins := make(map[string]*Override)
+	var excludes, adds []*Override
+	for _, o := range active {
+		switch o.Type {
+		case OverridePin:
+			pins[o.ServiceName] = o
+		case OverrideExclude:
+			excludes = append(excludes, o)
+		case OverrideAdd:
+			adds = append(adds, o)
+		}
+	}
+
+	excluded := func(name string, version uint64) bool {
+		for _, o := range excludes {
+			if o.ServiceName == name && (o.ServiceVersion == 0 || o.ServiceVersion == version) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var result ProvisionedServices
+	pinned := make(map[string]bool)
+	for _, service := range services {
+		if excluded(service.ServiceName, service.ServiceVersion) {
+			continue
+		}
+
+		pin, ok := pins[service.ServiceName]
+		if !ok {
+			result = append(result, service)
+			continue
+		}
+
+		// one service at the pinned version replaces all provisioned versions
+		if pinned[service.ServiceName] {
+			continue
+		}
+		pinned[service.ServiceName] = true
+
+		ps := *service
+		ps.ServiceVersion = pin.ServiceVersion
+		result = append(result, &ps)
+	}
+
+	for _, o := range adds {
+		if excluded(o.ServiceName, o.ServiceVersion) || result.Contains(o.ServiceName, o.ServiceVersion, o.ServiceType) {
+			continue
+		}
+
+		ps := &ProvisionedService{
+			ServiceName:    o.ServiceName,
+			ServiceVersion: o.ServiceVersion,
+			MachineClass:   machineClass,
+			ServiceType:    o.ServiceType,
+		}
+		loadSettings(ps)
+		result = append(result, ps)
+	}
+
+	return result
+}
+
+// withOverrides applies the overrides in the overrides file to services,
+// publishing events when overrides start or stop applying. If the file
+// can't be read the last overrides which could be are kept.
+func withOverrides(services ProvisionedServices, machineClass string) ProvisionedServices {
+	overridesMtx.Lock()
+	defer overridesMtx.Unlock()
+
+	active, err := readOverrides(time.Now())
+	if err != nil {
+		log.Errorf("Unable to read overrides, keeping the last ones: %v", err)
+		for _, o := range lastOverrides {
+			active = append(active, o)
+		}
+		return applyOverrides(services, active, machineClass)
+	}
+
+	current := make(map[string]*Override, len(active))
+	for _, o := range active {
+		current[o.String()] = o
+		if _, ok := lastOverrides[o.String()]; !ok {
+			log.Warnf("Overriding provisioned services: %v", o)
+			event.Overridden(o.ServiceName, o.ServiceVersion, o.String())
+		}
+	}
+	for desc, o := range lastOverrides {
+		if _, ok := current[desc]; !ok {
+			log.Infof("No longer overriding provisioned services: %v", o)
+			event.OverrideEnded(o.ServiceName, o.ServiceVersion, o.String())
+		}
+	}
+	lastOverrides = current
+
+	return applyOverrides(services, active, machineClass)
+}
+
+// peekOverrides applies the overrides in the overrides file to services,
+// like withOverrides, but without publishing events or recording them, for
+// callers which only look at what should run
+func peekOverrides(services ProvisionedServices, machineClass string) ProvisionedServices {
+	overridesMtx.Lock()
+	defer overridesMtx.Unlock()
+
+	active, err := readOverrides(time.Now())
+	if err != nil {
+		active = nil
+		for _, o := range lastOverrides {
+			active = append(active, o)
+		}
+	}
+
+	return applyOverrides(services, active, machineClass)
+}
+
+// Overrides returns the overrides applied to provisioned services on this
+// host, sorted by description
+func Overrides() []*Override {
+	overridesMtx.Lock()
+	defer overridesMtx.Unlock()
+
+	var descs []string
+	for desc := range lastOverrides {
+		descs = append(descs, desc)
+	}
+	sort.Strings(descs)
+
+	list := make([]*Override, 0, len(descs))
+	for _, desc := range descs {
+		list = append(list, lastOverrides[desc])
+	}
+	return list
+}
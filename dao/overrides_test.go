@@ -0,0 +1,97 @@
+package dao
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(f string) { overridesFile = f }(overridesFile)
+	overridesFile = filepath.Join(dir, "provisioning-overrides.json")
+
+	if active, err := readOverrides(time.Now()); err != nil || len(active) != 0 {
+		t.Errorf("Expected no overrides without a file, got %v %v", active, err)
+	}
+
+	ioutil.WriteFile(overridesFile, []byte(`{
+		"Pin": [{"ServiceName": "com.HailoOSS.service.foo", "ServiceVersion": 1, "Reason": "memory leak"}],
+		"Exclude": [{"ServiceName": "com.HailoOSS.service.bar", "Expires": "2000-01-01T00:00:00Z"}],
+		"Add": [{"ServiceName": "com.HailoOSS.service.baz"}]
+	}`), 0644)
+
+	active, err := readOverrides(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].Type != OverridePin || active[0].String() != "pin com.HailoOSS.service.foo-1: memory leak" {
+		t.Errorf("Expected only the pin to be active, got %v", active)
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	services := ProvisionedServices{
+		{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 2, CPU: 500},
+		{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 3, CPU: 500},
+		{ServiceName: "com.HailoOSS.service.bar", ServiceVersion: 1},
+		{ServiceName: "com.HailoOSS.service.qux", ServiceVersion: 1},
+	}
+	active := []*Override{
+		{Type: OverridePin, ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 1},
+		{Type: OverrideExclude, ServiceName: "com.HailoOSS.service.bar"},
+		{Type: OverrideAdd, ServiceName: "com.HailoOSS.service.baz", ServiceVersion: 4},
+	}
+
+	result := applyOverrides(services, active, "default")
+
+	if len(result) != 3 {
+		t.Fatalf("Expected 3 services, got %d", len(result))
+	}
+	if foo := result.Find("com.HailoOSS.service.foo", 1, ServiceTypeProcess); foo == nil || foo.CPU != 500 {
+		t.Errorf("Expected foo to be pinned to version 1 with its settings, got %v", foo)
+	}
+	if result.Contains("com.HailoOSS.service.bar", 1, ServiceTypeProcess) {
+		t.Error("Expected bar to be excluded")
+	}
+	if !result.Contains("com.HailoOSS.service.qux", 1, ServiceTypeProcess) {
+		t.Error("Expected qux to be left alone")
+	}
+	if baz := result.Find("com.HailoOSS.service.baz", 4, ServiceTypeProcess); baz == nil || baz.MachineClass != "default" {
+		t.Errorf("Expected baz to be added, got %v", baz)
+	}
+
+	if services[0].ServiceVersion != 2 {
+		t.Error("Expected the provisioned services not to be changed")
+	}
+}
+
+func TestPeekOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(f string) { overridesFile = f }(overridesFile)
+	overridesFile = filepath.Join(dir, "provisioning-overrides.json")
+
+	ioutil.WriteFile(overridesFile, []byte(`{
+		"Exclude": [{"ServiceName": "com.HailoOSS.service.foo"}]
+	}`), 0644)
+
+	services := ProvisionedServices{{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 1}}
+	if result := peekOverrides(services, "default"); len(result) != 0 {
+		t.Errorf("Expected the exclusion to apply, got %v", result)
+	}
+	if len(lastOverrides) != 0 {
+		t.Errorf("Expected peeking not to record overrides, got %v", lastOverrides)
+	}
+}
@@ -0,0 +1,21 @@
+package dao
+
+import (
+	"github.com/HailoOSS/service/config"
+)
+
+// RunLevel returns the current run level of a region, and whether one is set.
+// Services whose minimum run level is above it should not run. It is read
+// from the config service at hailo.provisioning.runLevels.<region>, since
+// provisioning manager doesn't hold run levels.
+func RunLevel(region string) (int64, bool) {
+	if len(region) == 0 {
+		return 0, false
+	}
+
+	level := config.AtPath("hailo", "provisioning", "runLevels", region).AsInt(-1)
+	if level < 0 {
+		return 0, false
+	}
+	return int64(level), true
+}
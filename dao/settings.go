@@ -0,0 +1,50 @@
+package dao
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/HailoOSS/service/config"
+	log "github.com/cihub/seelog"
+)
+
+// loadSettings adds per-service provisioning settings which provisioning
+// manager doesn't hold, read from the config service at
+// hailo.provisioning.<service-name>. The cpu and memory limits of the
+// service record can be overridden there too.
+func loadSettings(ps *ProvisionedService) {
+	service := strings.Replace(ps.ServiceName, ".", "-", -1)
+
+	if b := config.AtPath("hailo", "provisioning", service, "readiness").AsJson(); len(b) > 0 {
+		check := &ReadinessCheck{}
+		if err := json.Unmarshal(b, check); err != nil {
+			log.Warnf("Invalid readiness check for %s: %v", ps.ServiceName, err)
+		} else if len(check.Type) > 0 {
+			ps.Readiness = check
+		}
+	}
+
+	if cpu := config.AtPath("hailo", "provisioning", service, "cpu").AsInt(0); cpu > 0 {
+		ps.CPU = uint64(cpu)
+	}
+
+	if memory := config.AtPath("hailo", "provisioning", service, "memory").AsInt(0); memory > 0 {
+		ps.Memory = uint64(memory)
+	}
+
+	if b := config.AtPath("hailo", "provisioning", service, "env").AsJson(); len(b) > 0 {
+		if err := json.Unmarshal(b, &ps.Env); err != nil {
+			log.Warnf("Invalid environment for %s: %v", ps.ServiceName, err)
+		}
+	}
+
+	ps.Args = config.AtPath("hailo", "provisioning", service, "args").AsStringArray()
+
+	if instances := config.AtPath("hailo", "provisioning", service, "instances").AsInt(0); instances > 0 {
+		ps.Instances = uint64(instances)
+	}
+
+	ps.After = config.AtPath("hailo", "provisioning", service, "after").AsStringArray()
+	ps.Priority = config.AtPath("hailo", "provisioning", service, "priority").AsInt(0)
+	ps.RunLevel = int64(config.AtPath("hailo", "provisioning", service, "runLevel").AsInt(0))
+}
@@ -19,10 +19,39 @@ type ProvisionedService struct {
 	NoFileSoftLimit uint64
 	NoFileHardLimit uint64
 	ServiceType     ServiceType
+	Readiness       *ReadinessCheck   `json:",omitempty"`
+	CPU             uint64            `json:",omitempty"` // thousandths of a core, 0 is unlimited
+	Memory          uint64            `json:",omitempty"` // bytes, 0 is unlimited
+	Env             map[string]string `json:",omitempty"`
+	Args            []string          `json:",omitempty"`
+	Instances       uint64            `json:",omitempty"` // processes to run, 0 is 1
+	After           []string          `json:",omitempty"` // services to start before this one
+	Priority        int               `json:",omitempty"` // higher tiers start first, and stop last
+	RunLevel        int64             `json:",omitempty"` // lowest run level of the region the service runs at
+}
+
+// ReadinessCheck describes how to tell that a service has started properly.
+// Type is one of http, tcp, exec or alive; durations are strings such as "10s".
+type ReadinessCheck struct {
+	Type     string
+	URL      string   `json:",omitempty"` // http: url which must return 2xx
+	Address  string   `json:",omitempty"` // tcp: host:port which must accept connections
+	Command  []string `json:",omitempty"` // exec: command which must exit 0
+	Duration string   `json:",omitempty"` // alive: how long the process must stay up
+	Deadline string   `json:",omitempty"` // how long to wait for the service to be ready
+	Interval string   `json:",omitempty"` // how often to check
 }
 
 type ProvisionedServices []*ProvisionedService
 
+// DesiredInstances returns how many instances of a service should run
+func (ps *ProvisionedService) DesiredInstances() int {
+	if ps.Instances < 1 {
+		return 1
+	}
+	return int(ps.Instances)
+}
+
 func (ps *ProvisionedService) matches(name string, version uint64, typ ServiceType) bool {
 	if ps.ServiceName == name && ps.ServiceVersion == version && ps.ServiceType == typ {
 		return true
@@ -42,3 +71,44 @@ func (ps ProvisionedServices) Contains(name string, version uint64, typ ServiceT
 
 	return false
 }
+
+// OfType returns the provisioned services of a type
+func (ps ProvisionedServices) OfType(typ ServiceType) ProvisionedServices {
+	var services ProvisionedServices
+	for _, service := range ps {
+		if service.ServiceType == typ {
+			services = append(services, service)
+		}
+	}
+
+	return services
+}
+
+// Find returns the provisioned service with a name, version and type
+func (ps ProvisionedServices) Find(name string, version uint64, typ ServiceType) *ProvisionedService {
+	for _, service := range ps {
+		if service.matches(name, version, typ) {
+			return service
+		}
+	}
+
+	return nil
+}
+
+// Replacement finds a provisioned service with the same name and type but a
+// different version, which is replacing the given version. If there are
+// several, the newest is returned.
+func (ps ProvisionedServices) Replacement(name string, version uint64, typ ServiceType) *ProvisionedService {
+	var replacement *ProvisionedService
+	for _, service := range ps {
+		if service.ServiceName != name || service.ServiceType != typ || service.ServiceVersion == version {
+			continue
+		}
+
+		if replacement == nil || service.ServiceVersion > replacement.ServiceVersion {
+			replacement = service
+		}
+	}
+
+	return replacement
+}
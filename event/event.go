@@ -23,12 +23,28 @@ const (
 	provisionError   = "ERROR PROVISIONING"
 	deprovisionError = "ERROR DEPROVISIONING"
 	restarted        = "RESTARTED"
+	crashLooping     = "CRASH LOOPING"
+	rolledBack       = "ROLLED BACK"
+	maintenanceStart = "MAINTENANCE STARTED"
+	maintenanceEnd   = "MAINTENANCE ENDED"
+	overridden       = "OVERRIDDEN"
+	overrideEnded    = "OVERRIDE ENDED"
+	runLevelChanged  = "RUN LEVEL CHANGED"
+	stopsHeld        = "STOPS HELD"
 	eventTTL         = 60
 	eventExpiry      = 3600
 	nsqTopicName     = "platform.events"
+
+	provisioningService = "com.HailoOSS.kernel.provisioning"
 )
 
+// Publisher sends a message to a topic
+type Publisher func(topic string, payload proto.Message) error
+
 var (
+	// publish sends events, and can be replaced so tests don't send any
+	publish Publisher = client.Pub
+
 	mclass         string
 	hostname       string
 	azName         string
@@ -165,7 +181,7 @@ func (e *eventManager) pub(service string, version uint64, action, info string)
 
 	p := eventProto(service, version, action, info)
 
-	if err := client.Pub("com.HailoOSS.kernel.provisioning.event", p); err != nil {
+	if err := publish("com.HailoOSS.kernel.provisioning.event", p); err != nil {
 		log.Errorf("Failed to publish provisioning event: %v", err)
 		return
 	}
@@ -194,6 +210,17 @@ func (e *eventManager) pubNSQ(service string, version uint64, action, info, mCla
 	}
 }
 
+// SetPublisher replaces how events are published, returning the previous
+// publisher so it can be restored
+func SetPublisher(p Publisher) Publisher {
+	defaultManager.mtx.Lock()
+	defer defaultManager.mtx.Unlock()
+
+	previous := publish
+	publish = p
+	return previous
+}
+
 // ProvisionError publishes a provisioning error event.
 func ProvisionError(service string, version uint64, err string) {
 	defaultManager.pub(service, version, provisionError, err)
@@ -204,6 +231,54 @@ func DeprovisionError(service string, version uint64, err string) {
 	defaultManager.pub(service, version, deprovisionError, err)
 }
 
+// CrashLooping publishes an event for a service which keeps failing to start
+// or exiting soon after starting.
+func CrashLooping(service string, version uint64, info string) {
+	defaultManager.pub(service, version, crashLooping, info)
+}
+
+// RolledBack publishes an event for a service which was rolled back to a
+// previously known-good version.
+func RolledBack(service string, version uint64, info string) {
+	defaultManager.pub(service, version, rolledBack, info)
+}
+
+// MaintenanceStarted publishes an event, as the provisioning service itself,
+// for this host pausing provisioning.
+func MaintenanceStarted(info string) {
+	defaultManager.pub(provisioningService, 0, maintenanceStart, info)
+}
+
+// MaintenanceEnded publishes an event for this host resuming provisioning.
+func MaintenanceEnded(info string) {
+	defaultManager.pub(provisioningService, 0, maintenanceEnd, info)
+}
+
+// RunLevelChanged publishes an event, as the provisioning service itself,
+// for the run level of this host's region changing.
+func RunLevelChanged(info string) {
+	defaultManager.pub(provisioningService, 0, runLevelChanged, info)
+}
+
+// StopsHeld publishes a critical event, as the provisioning service itself
+// and to NSQ, for this host refusing to stop many services at once.
+func StopsHeld(info string) {
+	defaultManager.pub(provisioningService, 0, stopsHeld, info)
+	defaultManager.pubNSQ(provisioningService, 0, stopsHeld, info, mclass, "")
+}
+
+// Overridden publishes an event for a service whose provisioning is
+// overridden on this host.
+func Overridden(service string, version uint64, info string) {
+	defaultManager.pub(service, version, overridden, info)
+}
+
+// OverrideEnded publishes an event for a service whose provisioning is no
+// longer overridden on this host.
+func OverrideEnded(service string, version uint64, info string) {
+	defaultManager.pub(service, version, overrideEnded, info)
+}
+
 // Provisioned publishes a provisioning event which other services can listen for.
 func Provisioned(service string, version uint64) {
 	defaultManager.pub(service, version, provisioned, "")
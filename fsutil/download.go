@@ -0,0 +1,79 @@
+package fsutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// PartialExtension is added to the name of a file while it is downloaded.
+	// It is a fixed name, so the janitor finds it if we crash.
+	PartialExtension = ".part"
+)
+
+// BuildPath is where a version of a service is kept in our artifact
+// repositories, e.g. com/HailoOSS/service/foo/com.HailoOSS.service.foo-1
+func BuildPath(serviceName string, serviceVersion uint64) string {
+	return fmt.Sprintf(
+		"%v/%v-%v",
+		strings.Replace(serviceName, ".", "/", -1),
+		serviceName,
+		serviceVersion,
+	)
+}
+
+// Download writes what is read from r to filename, so that filename is never
+// left half written. It is written to a partial file alongside, checked by
+// verify if given, which is passed its sha256, and then made executable and
+// renamed into place.
+func Download(filename string, r io.Reader, verify func(sum string) error) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+
+	partPath := filename + PartialExtension
+	fh, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partPath)
+	defer fh.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(fh, hash), r); err != nil {
+		return err
+	}
+
+	if err := fh.Sync(); err != nil {
+		return err
+	}
+
+	if verify != nil {
+		if err := verify(hex.EncodeToString(hash.Sum(nil))); err != nil {
+			return err
+		}
+	}
+
+	return FinishDownload(filename)
+}
+
+// FinishDownload makes a complete partial download of filename executable
+// and renames it into place, syncing the directory so the rename survives a
+// crash
+func FinishDownload(filename string) error {
+	partPath := filename + PartialExtension
+	if err := os.Chmod(partPath, 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(partPath, filename); err != nil {
+		return err
+	}
+
+	return SyncDir(filepath.Dir(filename))
+}
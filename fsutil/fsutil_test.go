@@ -0,0 +1,73 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "state", "file.json")
+	for _, contents := range []string{"first", "second"} {
+		if err := WriteFile(name, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if b, err := ioutil.ReadFile(name); err != nil || string(b) != contents {
+			t.Errorf("Expected %q, got %q %v", contents, b, err)
+		}
+	}
+
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v %v", fi.Mode(), err)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Dir(name)); len(files) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %d files", len(files))
+	}
+}
+
+func TestDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "bin", "binary")
+	rejected := fmt.Errorf("rejected")
+	if err := Download(name, strings.NewReader("binary"), func(sum string) error { return rejected }); err != rejected {
+		t.Errorf("Expected the download to be rejected, got %v", err)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Dir(name)); len(files) != 0 {
+		t.Errorf("Expected nothing to be left of a rejected download, got %d files", len(files))
+	}
+
+	var sum string
+	if err := Download(name, strings.NewReader("binary"), func(s string) error { sum = s; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if sum != "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd" {
+		t.Errorf("Expected the sha256 of the download, got %s", sum)
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("Expected an executable download, got %v %v", fi, err)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Dir(name)); len(files) != 1 {
+		t.Errorf("Expected no partial download to be left, got %d files", len(files))
+	}
+}
+
+func TestBuildPath(t *testing.T) {
+	if p := BuildPath("com.HailoOSS.service.foo", 20130618183200); p != "com/HailoOSS/service/foo/com.HailoOSS.service.foo-20130618183200" {
+		t.Errorf("Unexpected build path %s", p)
+	}
+}
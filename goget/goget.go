@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/HailoOSS/provisioning-service/dao"
 	"github.com/HailoOSS/provisioning-service/process"
+	"github.com/HailoOSS/provisioning-service/verify"
 	"io"
 	"os"
 	"os/exec"
@@ -198,16 +199,26 @@ func (g *GoGetMgr) IsDownloaded(ps *dao.ProvisionedService) (bool, string) {
 // Delete removes a downloaded file, incase of errors copying
 func (g *GoGetMgr) Delete(ps *dao.ProvisionedService) error {
 	if ok, dst := g.IsDownloaded(ps); ok {
-		if err := os.Remove(fmt.Sprintf("%s.md5", dst)); err != nil {
-			return err
-		}
-
 		return os.Remove(dst)
 	}
 
 	return nil
 }
 
+// VerifyBinary treats binaries as unsigned, since we build them ourselves
+// from source and there is no published manifest to check against
 func (g *GoGetMgr) VerifyBinary(ps *dao.ProvisionedService) error {
+	return verify.Unsigned(process.ExePath(ps))
+}
+
+// Clean removes the sources and packages fetched by go get, which are
+// fetched again on the next build
+func (g *GoGetMgr) Clean() error {
+	for _, dir := range []string{"src", "pkg"} {
+		if err := os.RemoveAll(path.Join(g.GoPath, dir)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"fmt"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/platform/errors"
+	"github.com/HailoOSS/platform/server"
+	"github.com/HailoOSS/protobuf/proto"
+
+	changed "github.com/HailoOSS/provisioning-service/proto/changed"
+	"github.com/HailoOSS/provisioning-service/runner"
+)
+
+// Changed is told when provisions change, and checks services straight away
+// if they change on this host's machine class
+func Changed(req *server.Request) (proto.Message, errors.Error) {
+	request := &changed.Request{}
+	if err := req.Unmarshal(request); err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.changed", fmt.Sprintf("%v", err))
+	}
+
+	reason := "provisions changed"
+	if request.GetServiceName() != "" {
+		reason = fmt.Sprintf("%s-%d changed", request.GetServiceName(), request.GetServiceVersion())
+	}
+
+	if runner.Trigger(request.GetMachineClass(), reason) {
+		log.Debugf("Check triggered: %s", reason)
+	}
+
+	return &changed.Response{}, nil
+}
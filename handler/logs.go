@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/HailoOSS/platform/errors"
+	"github.com/HailoOSS/platform/server"
+	"github.com/HailoOSS/protobuf/proto"
+
+	"github.com/HailoOSS/provisioning-service/container"
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/logs"
+	"github.com/HailoOSS/provisioning-service/process"
+	logsproto "github.com/HailoOSS/provisioning-service/proto/logs"
+)
+
+// Logs returns part of the console or error log of a service on this host
+func Logs(req *server.Request) (proto.Message, errors.Error) {
+	request := &logsproto.Request{}
+	if err := req.Unmarshal(request); err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.logs", fmt.Sprintf("%v", err))
+	}
+
+	if !validServiceName(request.GetServiceName()) {
+		return nil, errors.BadRequest("com.HailoOSS.provisioning.handler.logs", fmt.Sprintf("Invalid service name %q", request.GetServiceName()))
+	}
+
+	stream := request.GetStream()
+	if stream == "" {
+		stream = logs.Console
+	}
+	if !logs.ValidStream(stream) {
+		return nil, errors.BadRequest("com.HailoOSS.provisioning.handler.logs", fmt.Sprintf("Unknown stream %q", stream))
+	}
+
+	q := logs.Query{
+		Lines:  int(request.GetLines()),
+		Bytes:  request.GetBytes(),
+		Follow: request.Offset != nil,
+		Offset: request.GetOffset(),
+	}
+
+	if request.GetGrep() != "" {
+		grep, err := regexp.Compile(request.GetGrep())
+		if err != nil {
+			return nil, errors.BadRequest("com.HailoOSS.provisioning.handler.logs", fmt.Sprintf("Invalid grep: %v", err))
+		}
+		q.Grep = grep
+	}
+
+	var result *logs.Result
+	var err error
+	switch request.GetServiceType() {
+	case "", dao.ServiceTypeByName[dao.ServiceTypeProcess]:
+		path := process.LogPath(request.GetServiceName(), request.GetServiceVersion(), int(request.GetInstance()), stream)
+		result, err = logs.ReadFile(path, q)
+		if os.IsNotExist(err) {
+			return nil, errors.NotFound("com.HailoOSS.provisioning.handler.logs", fmt.Sprintf("No %s log for %s-%d", stream, request.GetServiceName(), request.GetServiceVersion()))
+		}
+	case dao.ServiceTypeByName[dao.ServiceTypeContainer]:
+		// docker gives us the tail of the log, which offsets can't index
+		if q.Follow {
+			return nil, errors.BadRequest("com.HailoOSS.provisioning.handler.logs", "Container logs can't be followed by offset")
+		}
+		var buf bytes.Buffer
+		name := request.GetServiceName() + "-" + strconv.FormatUint(request.GetServiceVersion(), 10)
+		if err = container.Logs(name, stream == logs.Error, q.TailLines(), &buf); err == nil {
+			result, err = logs.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()), q)
+		}
+	default:
+		return nil, errors.BadRequest("com.HailoOSS.provisioning.handler.logs", fmt.Sprintf("Unknown service type %q", request.GetServiceType()))
+	}
+	if err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.logs", fmt.Sprintf("%v", err))
+	}
+
+	return &logsproto.Response{
+		Lines:  result.Lines,
+		Offset: proto.Int64(result.Offset),
+		Size:   proto.Int64(result.Size),
+	}, nil
+}
+
+// validServiceName returns whether a name is one of our services, so it can't
+// be used to read files outside the log directory
+func validServiceName(name string) bool {
+	return strings.HasPrefix(name, "com.HailoOSS.") && !strings.ContainsAny(name, "/\\") && !strings.Contains(name, "..")
+}
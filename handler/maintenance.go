@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HailoOSS/platform/errors"
+	"github.com/HailoOSS/platform/server"
+	"github.com/HailoOSS/protobuf/proto"
+
+	"github.com/HailoOSS/provisioning-service/maintenance"
+	maintenanceproto "github.com/HailoOSS/provisioning-service/proto/maintenance"
+)
+
+// Maintenance starts or ends maintenance of this host, during which services
+// are neither started nor stopped
+func Maintenance(req *server.Request) (proto.Message, errors.Error) {
+	request := &maintenanceproto.Request{}
+	if err := req.Unmarshal(request); err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.maintenance", fmt.Sprintf("%v", err))
+	}
+
+	if request.GetDuration() < 0 {
+		return nil, errors.BadRequest("com.HailoOSS.provisioning.handler.maintenance", "Duration must not be negative")
+	}
+
+	if request.Enabled != nil {
+		var err error
+		if request.GetEnabled() {
+			s := &maintenance.State{
+				Services: request.GetServices(),
+				Reason:   request.GetReason(),
+				User:     req.Auth().AuthUser().Id,
+			}
+			if d := request.GetDuration(); d > 0 {
+				s.Until = time.Now().Add(time.Duration(d) * time.Second)
+			}
+			err = maintenance.Start(s)
+		} else {
+			err = maintenance.End()
+		}
+		if err != nil {
+			return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.maintenance", fmt.Sprintf("%v", err))
+		}
+	}
+
+	s, err := maintenance.Current()
+	if err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.maintenance", fmt.Sprintf("%v", err))
+	}
+	if s == nil {
+		return &maintenanceproto.Response{Enabled: proto.Bool(false)}, nil
+	}
+
+	rsp := &maintenanceproto.Response{
+		Enabled:  proto.Bool(true),
+		Services: s.Services,
+		Started:  proto.Int64(s.Started.Unix()),
+		Reason:   proto.String(s.Reason),
+		User:     proto.String(s.User),
+	}
+	if !s.Until.IsZero() {
+		rsp.Until = proto.Int64(s.Until.Unix())
+	}
+	return rsp, nil
+}
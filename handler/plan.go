@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/HailoOSS/platform/errors"
+	"github.com/HailoOSS/platform/server"
+	"github.com/HailoOSS/protobuf/proto"
+	"github.com/HailoOSS/provisioning-service/dao"
+	plan "github.com/HailoOSS/provisioning-service/proto/plan"
+	"github.com/HailoOSS/provisioning-service/runner"
+)
+
+// Plan returns what the runner would do if it checked services on this host
+// now, without doing it
+func Plan(req *server.Request) (proto.Message, errors.Error) {
+	request := &plan.Request{}
+	if err := req.Unmarshal(request); err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.plan", fmt.Sprintf("%v", err))
+	}
+
+	p, err := runner.NewPlan()
+	if err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.plan", fmt.Sprintf("%v", err))
+	}
+
+	actions := make([]*plan.Action, len(p.Actions))
+	for i, a := range p.Actions {
+		actions[i] = &plan.Action{
+			ServiceName:    proto.String(a.ServiceName),
+			ServiceVersion: proto.Uint64(a.ServiceVersion),
+			ServiceType:    proto.String(dao.ServiceTypeByName[a.ServiceType]),
+			Action:         proto.String(a.Action),
+			Steps:          a.Steps,
+			Skipped:        proto.String(a.Skipped),
+			Instance:       proto.Int32(int32(a.Instance)),
+		}
+	}
+
+	return &plan.Response{
+		Created: proto.Int64(p.Created.Unix()),
+		Actions: actions,
+		Errors:  p.Errors,
+	}, nil
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/HailoOSS/platform/errors"
+	"github.com/HailoOSS/platform/server"
+	"github.com/HailoOSS/protobuf/proto"
+	"github.com/HailoOSS/provisioning-service/dao"
+	report "github.com/HailoOSS/provisioning-service/proto/report"
+	"github.com/HailoOSS/provisioning-service/runner"
+)
+
+// Report returns what the runner did in its last check on this host
+func Report(req *server.Request) (proto.Message, errors.Error) {
+	request := &report.Request{}
+	if err := req.Unmarshal(request); err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.report", fmt.Sprintf("%v", err))
+	}
+
+	r := runner.LastReport()
+	if r == nil {
+		return &report.Response{}, nil
+	}
+
+	actions := make([]*report.Action, len(r.Actions))
+	for i, a := range r.Actions {
+		actions[i] = &report.Action{
+			ServiceName:    proto.String(a.ServiceName),
+			ServiceVersion: proto.Uint64(a.ServiceVersion),
+			Instance:       proto.Int32(int32(a.Instance)),
+			ServiceType:    proto.String(dao.ServiceTypeByName[a.ServiceType]),
+			Action:         proto.String(a.Action),
+			Result:         proto.String(a.Result),
+			Reason:         proto.String(a.Reason),
+		}
+	}
+
+	return &report.Response{
+		Started:  proto.Int64(r.Started.Unix()),
+		Finished: proto.Int64(r.Finished.Unix()),
+		Actions:  actions,
+		Errors:   r.Errors,
+	}, nil
+}
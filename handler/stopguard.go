@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/HailoOSS/platform/errors"
+	"github.com/HailoOSS/platform/server"
+	"github.com/HailoOSS/protobuf/proto"
+
+	stopguard "github.com/HailoOSS/provisioning-service/proto/stopguard"
+	"github.com/HailoOSS/provisioning-service/runner"
+)
+
+// StopGuard returns the stops held by the stop guard, optionally confirming
+// them so they go ahead
+func StopGuard(req *server.Request) (proto.Message, errors.Error) {
+	request := &stopguard.Request{}
+	if err := req.Unmarshal(request); err != nil {
+		return nil, errors.InternalServerError("com.HailoOSS.provisioning.handler.stopguard", fmt.Sprintf("%v", err))
+	}
+
+	if request.GetConfirm() {
+		return &stopguard.Response{
+			Confirmed: runner.ConfirmStops(req.Auth().AuthUser().Id),
+		}, nil
+	}
+
+	return &stopguard.Response{
+		Held: runner.HeldStops(),
+	}, nil
+}
@@ -0,0 +1,137 @@
+// Package health checks that newly started services are ready to serve
+package health
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/process"
+)
+
+const (
+	checkHTTP  = "http"
+	checkTCP   = "tcp"
+	checkExec  = "exec"
+	checkAlive = "alive"
+
+	defaultDeadline = time.Minute
+	defaultInterval = time.Second
+	defaultAlive    = 10 * time.Second
+)
+
+// IsRunning reports whether the service being checked is still running
+type IsRunning func() bool
+
+// WaitReady blocks until the readiness check of a service passes. It fails if
+// the service stops running, or is not ready before the check's deadline.
+// Services without a readiness check are ready straight away.
+func WaitReady(service *dao.ProvisionedService, running IsRunning) error {
+	check := service.Readiness
+	if check == nil {
+		return nil
+	}
+
+	deadline := duration(check.Deadline, defaultDeadline)
+	interval := duration(check.Interval, defaultInterval)
+	started := time.Now()
+
+	probe, err := newProbe(check, interval)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for {
+		if !running() {
+			return fmt.Errorf("service exited before it was ready")
+		}
+
+		if lastErr = probe(started); lastErr == nil {
+			log.Debugf("Service %s-%d ready after %v", service.ServiceName, service.ServiceVersion, time.Since(started))
+			return nil
+		}
+
+		if time.Since(started)+interval > deadline {
+			return fmt.Errorf("service not ready after %v: %v", deadline, lastErr)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// newProbe returns a function which checks readiness once
+func newProbe(check *dao.ReadinessCheck, timeout time.Duration) (func(started time.Time) error, error) {
+	switch check.Type {
+	case checkHTTP:
+		if len(check.URL) == 0 {
+			return nil, fmt.Errorf("http readiness check needs a url")
+		}
+		client := &http.Client{Timeout: timeout}
+		return func(time.Time) error {
+			rsp, err := client.Get(check.URL)
+			if err != nil {
+				return err
+			}
+			rsp.Body.Close()
+			if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+				return fmt.Errorf("%s returned %s", check.URL, rsp.Status)
+			}
+			return nil
+		}, nil
+	case checkTCP:
+		if len(check.Address) == 0 {
+			return nil, fmt.Errorf("tcp readiness check needs an address")
+		}
+		return func(time.Time) error {
+			conn, err := net.DialTimeout("tcp", check.Address, timeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}, nil
+	case checkExec:
+		if len(check.Command) == 0 {
+			return nil, fmt.Errorf("exec readiness check needs a command")
+		}
+		// the command comes from config, so it runs with no more privilege
+		// than the service has
+		return func(time.Time) error {
+			cmd, err := process.Command(check.Command[0], check.Command[1:]...)
+			if err != nil {
+				return fmt.Errorf("%v: %v", check.Command, err)
+			}
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("%v: %v %s", check.Command, err, out)
+			}
+			return nil
+		}, nil
+	case checkAlive:
+		alive := duration(check.Duration, defaultAlive)
+		return func(started time.Time) error {
+			if up := time.Since(started); up < alive {
+				return fmt.Errorf("up for %v, needs %v", up, alive)
+			}
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown readiness check type %q", check.Type)
+}
+
+func duration(s string, def time.Duration) time.Duration {
+	if len(s) == 0 {
+		return def
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Warnf("Invalid readiness duration %q, using %v", s, def)
+		return def
+	}
+	return d
+}
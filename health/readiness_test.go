@@ -0,0 +1,119 @@
+package health
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/user"
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+func alwaysRunning() bool { return true }
+
+func service(check *dao.ReadinessCheck) *dao.ProvisionedService {
+	return &dao.ProvisionedService{
+		ServiceName:    "com.HailoOSS.service.foo",
+		ServiceVersion: 20130618183200,
+		Readiness:      check,
+	}
+}
+
+func TestWaitReadyHTTP(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	check := &dao.ReadinessCheck{Type: "http", URL: srv.URL, Interval: "10ms", Deadline: "1s"}
+	if err := WaitReady(service(check), alwaysRunning); err != nil {
+		t.Fatalf("Expected service to become ready, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 checks, got %d", calls)
+	}
+}
+
+func TestWaitReadyTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+
+	check := &dao.ReadinessCheck{Type: "tcp", Address: addr, Interval: "10ms", Deadline: "100ms"}
+	if err := WaitReady(service(check), alwaysRunning); err != nil {
+		t.Errorf("Expected service to be ready, got %v", err)
+	}
+
+	l.Close()
+	if err := WaitReady(service(check), alwaysRunning); err == nil {
+		t.Error("Expected service not to be ready once nothing is listening")
+	}
+}
+
+// runAsMe runs commands for services as the current user
+func runAsMe(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("HAILO_INIT_RUNASUSER", u.Username)
+	t.Setenv("HAILO_INIT_RUNASGROUP", g.Name)
+}
+
+func TestWaitReadyExec(t *testing.T) {
+	runAsMe(t)
+
+	check := &dao.ReadinessCheck{Type: "exec", Command: []string{"true"}}
+	if err := WaitReady(service(check), alwaysRunning); err != nil {
+		t.Errorf("Expected service to be ready, got %v", err)
+	}
+
+	check = &dao.ReadinessCheck{Type: "exec", Command: []string{"false"}, Interval: "10ms", Deadline: "50ms"}
+	if err := WaitReady(service(check), alwaysRunning); err == nil {
+		t.Error("Expected service not to be ready when the command fails")
+	}
+}
+
+func TestWaitReadyExecEnvironment(t *testing.T) {
+	runAsMe(t)
+	t.Setenv("PROVISIONING_SECRET", "secret")
+
+	// only the environment services get is passed on
+	check := &dao.ReadinessCheck{Type: "exec", Command: []string{"sh", "-c", `test -z "$PROVISIONING_SECRET"`}, Interval: "10ms", Deadline: "50ms"}
+	if err := WaitReady(service(check), alwaysRunning); err != nil {
+		t.Errorf("Expected the command not to see our environment, got %v", err)
+	}
+}
+
+func TestWaitReadyAlive(t *testing.T) {
+	check := &dao.ReadinessCheck{Type: "alive", Duration: "30ms", Interval: "10ms"}
+	if err := WaitReady(service(check), alwaysRunning); err != nil {
+		t.Errorf("Expected service to be ready, got %v", err)
+	}
+
+	if err := WaitReady(service(check), func() bool { return false }); err == nil {
+		t.Error("Expected service which exited not to be ready")
+	}
+}
+
+func TestWaitReadyNoCheck(t *testing.T) {
+	if err := WaitReady(service(nil), func() bool { return false }); err != nil {
+		t.Errorf("Expected service without a check to be ready, got %v", err)
+	}
+
+	if err := WaitReady(service(&dao.ReadinessCheck{Type: "magic"}), alwaysRunning); err == nil {
+		t.Error("Expected an error for an unknown check type")
+	}
+}
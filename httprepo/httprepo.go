@@ -0,0 +1,330 @@
+package httprepo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/fsutil"
+	"github.com/HailoOSS/provisioning-service/process"
+	"github.com/HailoOSS/provisioning-service/verify"
+)
+
+const (
+	buildsRepo        = "hailo-builds"
+	requestTimeout    = time.Minute
+	checksumExtension = ".sha256"
+)
+
+var (
+	// how long reading a response may stall before the request is abandoned
+	idleTimeout = time.Minute
+)
+
+// HTTPMgr fetches artifacts from a plain HTTP(S) artifact store laid out as
+// <BaseURL>/<repo>/<path>, where repo is hailo-builds for binaries or the
+// deps prefix for dependencies
+type HTTPMgr struct {
+	BaseURL string
+	Headers http.Header
+
+	client *http.Client
+	mtx    sync.Mutex
+	etags  map[string]string
+}
+
+func New() *HTTPMgr {
+	return &HTTPMgr{
+		BaseURL: strings.TrimRight(os.Getenv("H2O_HTTP_REPO_URL"), "/"),
+		Headers: make(http.Header),
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: requestTimeout,
+			},
+		},
+		etags: make(map[string]string),
+	}
+}
+
+// loadHeaders reads auth headers from a file of "Name: value" lines, so that
+// credentials don't need to live in the environment
+func loadHeaders(name string, headers http.Header) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid header line in %s: %q", name, line)
+		}
+		headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return scanner.Err()
+}
+
+func (h *HTTPMgr) url(repo, remotePath string) string {
+	return h.BaseURL + "/" + strings.Trim(repo, "/") + "/" + strings.TrimLeft(remotePath, "/")
+}
+
+func (h *HTTPMgr) request(method, url string) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range h.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	return req, nil
+}
+
+// do sends a request, abandoning it if reading the response stalls for
+// longer than idleTimeout, however long the whole response takes
+func (h *HTTPMgr) do(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &idleBody{
+		ReadCloser: resp.Body,
+		timer:      time.AfterFunc(idleTimeout, cancel),
+		cancel:     cancel,
+	}
+	return resp, nil
+}
+
+// idleBody is a response body whose request is cancelled when its timer
+// fires, which each read puts off
+type idleBody struct {
+	io.ReadCloser
+	timer  *time.Timer
+	cancel context.CancelFunc
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Reset(idleTimeout)
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// get fetches a file, returning nil if it does not exist
+func (h *HTTPMgr) get(url string) ([]byte, error) {
+	req, err := h.request("GET", url)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+}
+
+// Setup is not an init() function since it must not be run during the build process
+func (h *HTTPMgr) Setup() error {
+	if len(h.BaseURL) == 0 {
+		return fmt.Errorf("H2O_HTTP_REPO_URL is undefined")
+	}
+
+	if name := os.Getenv("H2O_HTTP_REPO_HEADERS_FILE"); len(name) > 0 {
+		if err := loadHeaders(name, h.Headers); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Download will download the binary/JAR for this provisioned service from the
+// artifact store and store within the local filesystem, returning the full
+// path to the new file
+func (h *HTTPMgr) Download(ps *dao.ProvisionedService) (string, error) {
+	return h.DownloadFile(buildsRepo, fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion), process.ExePath(ps))
+}
+
+// DownloadFile retrieves a file from the artifact store. It is written to a
+// partial file alongside localPath, checked against the checksum sidecar if
+// one is published, and then renamed into place.
+func (h *HTTPMgr) DownloadFile(repo, remotePath, localPath string) (string, error) {
+	url := h.url(repo, remotePath)
+
+	req, err := h.request("GET", url)
+	if err != nil {
+		return localPath, err
+	}
+
+	resp, err := h.do(req)
+	if err != nil {
+		return localPath, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return localPath, fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+
+	err = fsutil.Download(localPath, resp.Body, func(sum string) error {
+		return h.verifyChecksum(url, sum)
+	})
+	return localPath, err
+}
+
+// verifyChecksum compares a sha256 against the checksum sidecar for url. The
+// sidecar may be in sha256sum format, with the filename after the digest.
+func (h *HTTPMgr) verifyChecksum(url, sum string) error {
+	b, err := h.get(url + checksumExtension)
+	if err != nil {
+		return err
+	}
+
+	if b == nil {
+		log.Debugf("Missing checksum for %s... ignoring", url)
+		return nil
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return fmt.Errorf("Empty checksum for %s", url)
+	}
+
+	if !strings.EqualFold(fields[0], sum) {
+		return fmt.Errorf("Failed to verify sha256 for %s. Downloaded %s, checksum file %s", url, sum, fields[0])
+	}
+
+	return nil
+}
+
+// Exists will check if this provisioned service exists in the artifact store
+// (this is our test of whether it is a valid provisioned service)
+func (h *HTTPMgr) Exists(ps *dao.ProvisionedService) (bool, error) {
+	return h.FileExists(buildsRepo, fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion))
+}
+
+// FileExists checks whether a file exists in the artifact store. The last
+// ETag seen is sent with each check so unchanged files cost a 304.
+func (h *HTTPMgr) FileExists(repo, remotePath string) (bool, error) {
+	url := h.url(repo, remotePath)
+
+	req, err := h.request("HEAD", url)
+	if err != nil {
+		return false, err
+	}
+
+	h.mtx.Lock()
+	etag, ok := h.etags[url]
+	h.mtx.Unlock()
+
+	if ok {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := h.do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return true, nil
+	case http.StatusOK:
+		h.mtx.Lock()
+		if etag := resp.Header.Get("ETag"); len(etag) > 0 {
+			h.etags[url] = etag
+		} else {
+			delete(h.etags, url)
+		}
+		h.mtx.Unlock()
+		return true, nil
+	case http.StatusNotFound:
+		h.mtx.Lock()
+		delete(h.etags, url)
+		h.mtx.Unlock()
+		return false, nil
+	}
+
+	return false, fmt.Errorf("HEAD %s returned %s", url, resp.Status)
+}
+
+// IsDownloaded will check if we have already downloaded this binary/JAR to
+// the local filesystem, returning the full path to the file
+func (h *HTTPMgr) IsDownloaded(ps *dao.ProvisionedService) (bool, string) {
+	dst := process.ExePath(ps)
+	if _, err := os.Stat(dst); err != nil {
+		return false, dst
+	}
+
+	return true, dst
+}
+
+// Delete removes a downloaded file, incase of errors copying
+func (h *HTTPMgr) Delete(ps *dao.ProvisionedService) error {
+	if ok, dst := h.IsDownloaded(ps); ok {
+		log.Infof("Removing provisioned binary: %v", ps)
+		return os.Remove(dst)
+	}
+
+	return nil
+}
+
+// VerifyBinary fetches the signed manifest for a binary if it exists and
+// checks the signature and sha256 against the downloaded binary
+func (h *HTTPMgr) VerifyBinary(ps *dao.ProvisionedService) error {
+	url := h.url(buildsRepo, fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion))
+
+	manifest, err := h.get(verify.ManifestPath(url))
+	if err != nil {
+		return err
+	}
+
+	signature, err := h.get(verify.SignaturePath(url))
+	if err != nil {
+		return err
+	}
+
+	return verify.Binary(ps, process.ExePath(ps), manifest, signature)
+}
@@ -0,0 +1,144 @@
+package httprepo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRepo(t *testing.T, files map[string]string) *HTTPMgr {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		contents, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		sum := sha256.Sum256([]byte(contents))
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(contents))
+	}))
+	t.Cleanup(server.Close)
+
+	h := New()
+	h.BaseURL = server.URL
+	h.Headers.Set("Authorization", "Bearer secret")
+	return h
+}
+
+func TestFileExists(t *testing.T) {
+	h := newTestRepo(t, map[string]string{
+		"/hailo-builds/com/HailoOSS/service/foo/com.HailoOSS.service.foo-20130618183200": "binary",
+	})
+
+	for i := 0; i < 2; i++ {
+		ok, err := h.FileExists("hailo-builds", "com/HailoOSS/service/foo/com.HailoOSS.service.foo-20130618183200")
+		if err != nil || !ok {
+			t.Errorf("Expected file to exist, got %v %v", ok, err)
+		}
+	}
+
+	if len(h.etags) != 1 {
+		t.Errorf("Expected the etag to be cached, got %v", h.etags)
+	}
+
+	ok, err := h.FileExists("hailo-builds", "com/HailoOSS/service/foo/com.HailoOSS.service.foo-20130618183201")
+	if err != nil || ok {
+		t.Errorf("Expected file not to exist, got %v %v", ok, err)
+	}
+
+	h.Headers.Del("Authorization")
+	if _, err := h.FileExists("hailo-builds", "com/HailoOSS/service/foo/com.HailoOSS.service.foo-20130618183200"); err == nil {
+		t.Error("Expected an error without auth")
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	sum := sha256.Sum256([]byte("dependency"))
+	h := newTestRepo(t, map[string]string{
+		"/hailo-deps/good":        "dependency",
+		"/hailo-deps/good.sha256": hex.EncodeToString(sum[:]) + "  good\n",
+		"/hailo-deps/bad":         "tampered",
+		"/hailo-deps/bad.sha256":  hex.EncodeToString(sum[:]) + "  bad\n",
+		"/hailo-deps/nosum":       "dependency",
+	})
+
+	dir, err := ioutil.TempDir("", "httprepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"good", "nosum"} {
+		localPath := filepath.Join(dir, name)
+		if _, err := h.DownloadFile("hailo-deps", name, localPath); err != nil {
+			t.Errorf("Error downloading %s: %v", name, err)
+			continue
+		}
+
+		if b, _ := ioutil.ReadFile(localPath); string(b) != "dependency" {
+			t.Errorf("Unexpected contents for %s: %q", name, b)
+		}
+	}
+
+	for _, name := range []string{"bad", "missing"} {
+		if _, err := h.DownloadFile("hailo-deps", name, filepath.Join(dir, name)); err == nil {
+			t.Errorf("Expected an error downloading %s", name)
+		}
+	}
+
+	// only the good files should be left, with no partial downloads
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("Expected 2 files after downloading, got %d", len(files))
+	}
+}
+
+func TestDownloadStalled(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("part of a binary"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	defer func(d time.Duration) { idleTimeout = d }(idleTimeout)
+	idleTimeout = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "httprepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := New()
+	h.BaseURL = server.URL
+	if _, err := h.DownloadFile("hailo-builds", "stalled", filepath.Join(dir, "stalled")); err == nil {
+		t.Error("Expected a stalled download to fail")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected nothing to be left of a stalled download, got %d files", len(files))
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"github.com/HailoOSS/platform/util"
 	"github.com/HailoOSS/protobuf/proto"
 	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/maintenance"
+	pprocess "github.com/HailoOSS/provisioning-service/process"
 	iproto "github.com/HailoOSS/provisioning-service/proto"
 )
 
@@ -113,13 +115,13 @@ func getServices(cpu sigar.Cpu) (map[string][]*iproto.Service, error) {
 		return nil, err
 	}
 
-	types := make(map[string]dao.ServiceType)
+	provisioned := make(map[string]*dao.ProvisionedService)
 	processes := make(map[string][]*iproto.Service)
 	services, _ := dao.CachedServices(machineClass)
 
 	for _, service := range services {
 		key := fmt.Sprintf("%s-%d", service.ServiceName, service.ServiceVersion)
-		types[key] = service.ServiceType
+		provisioned[key] = service
 	}
 
 	for proc, u := range procs {
@@ -136,13 +138,23 @@ func getServices(cpu sigar.Cpu) (map[string][]*iproto.Service, error) {
 			Usage:   usage,
 		}
 
-		var typ string
+		typ := "process"
 		key := fmt.Sprintf("%s-%s", name, version)
-		switch types[key] {
-		case dao.ServiceTypeContainer:
-			typ = "container"
-		default:
-			typ = "process"
+		if service, ok := provisioned[key]; ok {
+			if service.ServiceType == dao.ServiceTypeContainer {
+				typ = "container"
+			}
+
+			if service.CPU > 0 || service.Memory > 0 {
+				process.Allocation = &iproto.Resource{
+					Cpu:    proto.Float64(float64(service.CPU) / 10),
+					Memory: proto.Uint64(service.Memory),
+				}
+			}
+
+			if typ == "process" {
+				process.OomKills = proto.Uint64(pprocess.OOMKills(service.ServiceName, service.ServiceVersion))
+			}
 		}
 
 		processes[typ] = append(processes[typ], process)
@@ -152,6 +164,67 @@ func getServices(cpu sigar.Cpu) (map[string][]*iproto.Service, error) {
 	return processes, nil
 }
 
+// getMaintenance describes the maintenance this host is in, if any
+func getMaintenance() *iproto.Maintenance {
+	m, err := maintenance.Current()
+	if err != nil {
+		log.Warnf("Error reading maintenance state: %v", err)
+	}
+	if m == nil {
+		return nil
+	}
+
+	info := &iproto.Maintenance{
+		Services: m.Services,
+		Started:  proto.Uint64(uint64(m.Started.Unix())),
+		Reason:   proto.String(m.Reason),
+	}
+	if !m.Until.IsZero() {
+		info.Until = proto.Uint64(uint64(m.Until.Unix()))
+	}
+	return info
+}
+
+// getOverrides describes the local overrides of provisioned services
+func getOverrides() []*iproto.Override {
+	var overrides []*iproto.Override
+	for _, o := range dao.Overrides() {
+		override := &iproto.Override{
+			Type:        proto.String(o.Type),
+			ServiceName: proto.String(o.ServiceName),
+			Reason:      proto.String(o.Reason),
+		}
+		if o.ServiceVersion > 0 {
+			override.ServiceVersion = proto.Uint64(o.ServiceVersion)
+		}
+		if !o.Expires.IsZero() {
+			override.Expires = proto.Uint64(uint64(o.Expires.Unix()))
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides
+}
+
+// getCache describes the provisioned services last loaded, and how old they are
+func getCache() *iproto.Cache {
+	c := dao.Cache()
+	if c == nil {
+		return nil
+	}
+
+	age := c.Age()
+	if age < 0 {
+		age = 0
+	}
+
+	return &iproto.Cache{
+		Fetched:   proto.Uint64(uint64(c.Fetched.Unix())),
+		Age:       proto.Uint64(uint64(age.Seconds())),
+		Source:    proto.String(c.Source),
+		FromCache: proto.Bool(c.FromCache),
+	}
+}
+
 func pubInfo() error {
 	cpu, _ := getCpu()
 	delta := (*cpu).Delta(*cpuSample)
@@ -171,6 +244,9 @@ func pubInfo() error {
 		Machine:      machineInfo,
 		Processes:    services["process"],
 		Containers:   services["container"],
+		Maintenance:  getMaintenance(),
+		Overrides:    getOverrides(),
+		Cache:        getCache(),
 	})
 }
 
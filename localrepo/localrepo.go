@@ -0,0 +1,134 @@
+package localrepo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/fsutil"
+	"github.com/HailoOSS/provisioning-service/process"
+	"github.com/HailoOSS/provisioning-service/verify"
+)
+
+const (
+	buildsRepo = "hailo-builds"
+)
+
+// LocalMgr fetches artifacts from a local or mounted directory, laid out the
+// same way as our S3 buckets: <Dir>/<bucket>/<path>
+type LocalMgr struct {
+	Dir string
+}
+
+func New() *LocalMgr {
+	return &LocalMgr{
+		Dir: os.Getenv("H2O_LOCAL_REPO_DIR"),
+	}
+}
+
+func (l *LocalMgr) path(repo, remotePath string) string {
+	return filepath.Join(l.Dir, repo, filepath.FromSlash(remotePath))
+}
+
+// readFile reads a small file from the repo, returning nil if it does not exist
+func (l *LocalMgr) readFile(repo, remotePath string) ([]byte, error) {
+	b, err := ioutil.ReadFile(l.path(repo, remotePath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return b, err
+}
+
+// Setup is not an init() function since it must not be run during the build process
+func (l *LocalMgr) Setup() error {
+	if len(l.Dir) == 0 {
+		return fmt.Errorf("H2O_LOCAL_REPO_DIR is undefined")
+	}
+
+	if fi, err := os.Stat(l.Dir); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", l.Dir)
+	}
+
+	return nil
+}
+
+// Download will copy the binary/JAR for this provisioned service from the
+// repo to the local filesystem, returning the full path to the new file
+func (l *LocalMgr) Download(ps *dao.ProvisionedService) (string, error) {
+	return l.DownloadFile(buildsRepo, fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion), process.ExePath(ps))
+}
+
+// DownloadFile copies a file from the repo. It is written to a partial file
+// alongside localPath and then renamed into place.
+func (l *LocalMgr) DownloadFile(repo, remotePath, localPath string) (string, error) {
+	src, err := os.Open(l.path(repo, remotePath))
+	if err != nil {
+		return localPath, err
+	}
+	defer src.Close()
+
+	return localPath, fsutil.Download(localPath, src, nil)
+}
+
+// Exists will check if this provisioned service exists in the repo (this is
+// our test of whether it is a valid provisioned service)
+func (l *LocalMgr) Exists(ps *dao.ProvisionedService) (bool, error) {
+	return l.FileExists(buildsRepo, fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion))
+}
+
+// FileExists checks whether a file exists in the repo
+func (l *LocalMgr) FileExists(repo, remotePath string) (bool, error) {
+	_, err := os.Stat(l.path(repo, remotePath))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// IsDownloaded will check if we have already downloaded this binary/JAR to
+// the local filesystem, returning the full path to the file
+func (l *LocalMgr) IsDownloaded(ps *dao.ProvisionedService) (bool, string) {
+	dst := process.ExePath(ps)
+	if _, err := os.Stat(dst); err != nil {
+		return false, dst
+	}
+
+	return true, dst
+}
+
+// Delete removes a downloaded file, incase of errors copying
+func (l *LocalMgr) Delete(ps *dao.ProvisionedService) error {
+	if ok, dst := l.IsDownloaded(ps); ok {
+		log.Infof("Removing provisioned binary: %v", ps)
+		return os.Remove(dst)
+	}
+
+	return nil
+}
+
+// VerifyBinary reads the signed manifest for a binary if it exists and checks
+// the signature and sha256 against the downloaded binary
+func (l *LocalMgr) VerifyBinary(ps *dao.ProvisionedService) error {
+	manifest, err := l.readFile(buildsRepo, verify.ManifestPath(fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion)))
+	if err != nil {
+		return err
+	}
+
+	signature, err := l.readFile(buildsRepo, verify.SignaturePath(fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion)))
+	if err != nil {
+		return err
+	}
+
+	return verify.Binary(ps, process.ExePath(ps), manifest, signature)
+}
@@ -0,0 +1,62 @@
+package localrepo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+func TestDownloadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := &LocalMgr{Dir: filepath.Join(dir, "repo")}
+	build := filepath.Join(l.Dir, "hailo-builds", "com/HailoOSS/service/foo/com.HailoOSS.service.foo-20130618183200")
+	os.MkdirAll(filepath.Dir(build), 0755)
+	if err := ioutil.WriteFile(build, []byte("binary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := l.Exists(&dao.ProvisionedService{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 20130618183200})
+	if err != nil || !ok {
+		t.Errorf("Expected build to exist, got %v %v", ok, err)
+	}
+
+	ok, err = l.Exists(&dao.ProvisionedService{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 20130618183201})
+	if err != nil || ok {
+		t.Errorf("Expected build not to exist, got %v %v", ok, err)
+	}
+
+	localPath := filepath.Join(dir, "bin", "foo")
+	if _, err := l.DownloadFile("hailo-builds", "com/HailoOSS/service/foo/com.HailoOSS.service.foo-20130618183200", localPath); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Errorf("Expected downloaded file to be executable, got %v", fi.Mode())
+	}
+
+	if _, err := l.DownloadFile("hailo-builds", "missing", filepath.Join(dir, "bin", "missing")); err == nil {
+		t.Error("Expected an error downloading a missing file")
+	}
+
+	// only the downloaded file should be left, with no partial copies
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "bin"))
+	if len(files) != 1 {
+		t.Errorf("Expected 1 file after downloading, got %d", len(files))
+	}
+}
@@ -0,0 +1,207 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+const (
+	// Console is the stdout of a service
+	Console = "console"
+	// Error is the stderr of a service
+	Error = "error"
+
+	defaultLines = 100
+	maxLines     = 10000
+	// maxBytes caps how much of a log is read for a single request
+	maxBytes = 1 << 20
+)
+
+// Query selects part of a log
+type Query struct {
+	// Lines is the number of lines to return from the end of the log
+	Lines int
+	// Bytes returns the end of the log by size rather than by lines
+	Bytes int64
+	// Follow returns what was written after Offset, rather than the end of
+	// the log. Pass back the offset of the last result to follow a log.
+	Follow bool
+	Offset int64
+	// Grep only returns lines which match
+	Grep *regexp.Regexp
+}
+
+// Result is part of a log
+type Result struct {
+	Lines []string
+	// Offset is where the result ends, to read from next
+	Offset int64
+	// Size of the whole log
+	Size int64
+}
+
+// lines returns how many lines to return from the end of a log
+func (q Query) lines() int {
+	lines := q.Lines
+	if lines <= 0 {
+		lines = defaultLines
+	}
+	if lines > maxLines {
+		lines = maxLines
+	}
+	return lines
+}
+
+// TailLines returns how many lines from the end of a log are needed to
+// answer the query, for logs which can only be read from the end
+func (q Query) TailLines() int {
+	if q.Follow || q.Bytes > 0 || q.Grep != nil {
+		return maxLines
+	}
+	return q.lines()
+}
+
+// ValidStream returns whether a stream is one services write
+func ValidStream(stream string) bool {
+	return stream == Console || stream == Error
+}
+
+// ReadFile reads part of a log file
+func ReadFile(path string, q Query) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Read(f, fi.Size(), q)
+}
+
+// Read reads part of a log of a given size
+func Read(r io.ReaderAt, size int64, q Query) (*Result, error) {
+	if q.Follow {
+		return follow(r, size, q)
+	}
+	return tail(r, size, q)
+}
+
+// follow returns whole lines written after the offset
+func follow(r io.ReaderAt, size int64, q Query) (*Result, error) {
+	start := q.Offset
+	if start > size {
+		// the log has been truncated or rotated, start again
+		start = 0
+	}
+
+	end := size
+	if end-start > maxBytes {
+		end = start + maxBytes
+	}
+
+	buf, err := readRange(r, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// leave a partly written line for next time, unless it is all we have
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i+1]
+	} else if end-start < maxBytes {
+		buf = nil
+	}
+
+	return &Result{
+		Lines:  filter(splitLines(buf), q.Grep),
+		Offset: start + int64(len(buf)),
+		Size:   size,
+	}, nil
+}
+
+// tail returns the last lines or bytes of a log
+func tail(r io.ReaderAt, size int64, q Query) (*Result, error) {
+	n := int64(maxBytes)
+	if q.Bytes > 0 && q.Bytes < n {
+		n = q.Bytes
+	}
+
+	start := size - n
+	if start < 0 {
+		start = 0
+	}
+
+	buf, err := readRange(r, start, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Bytes > 0 {
+		return &Result{
+			Lines:  filter(splitLines(buf), q.Grep),
+			Offset: size,
+			Size:   size,
+		}, nil
+	}
+
+	// drop the line we started part way through
+	if start > 0 {
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			buf = buf[i+1:]
+		}
+	}
+
+	lines := q.lines()
+	matching := filter(splitLines(buf), q.Grep)
+	if len(matching) > lines {
+		matching = matching[len(matching)-lines:]
+	}
+
+	return &Result{
+		Lines:  matching,
+		Offset: size,
+		Size:   size,
+	}, nil
+}
+
+func readRange(r io.ReaderAt, start, end int64) ([]byte, error) {
+	buf := make([]byte, end-start)
+	n, err := r.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to read log: %v", err)
+	}
+	return buf[:n], nil
+}
+
+func splitLines(buf []byte) []string {
+	buf = bytes.TrimSuffix(buf, []byte("\n"))
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var lines []string
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func filter(lines []string, grep *regexp.Regexp) []string {
+	if grep == nil {
+		return lines
+	}
+
+	var matching []string
+	for _, line := range lines {
+		if grep.MatchString(line) {
+			matching = append(matching, line)
+		}
+	}
+	return matching
+}
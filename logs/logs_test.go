@@ -0,0 +1,78 @@
+package logs
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func read(t *testing.T, log string, q Query) *Result {
+	result, err := Read(strings.NewReader(log), int64(len(log)), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestTail(t *testing.T) {
+	log := "one\ntwo\nthree\nfour\n"
+
+	if r := read(t, log, Query{Lines: 2}); !reflect.DeepEqual(r.Lines, []string{"three", "four"}) {
+		t.Errorf("Expected the last 2 lines, got %q", r.Lines)
+	}
+
+	if r := read(t, log, Query{}); len(r.Lines) != 4 || r.Offset != int64(len(log)) {
+		t.Errorf("Expected all lines and the end offset, got %q at %d", r.Lines, r.Offset)
+	}
+
+	if r := read(t, log, Query{Bytes: 8}); !reflect.DeepEqual(r.Lines, []string{"ee", "four"}) {
+		t.Errorf("Expected the last 8 bytes, got %q", r.Lines)
+	}
+
+	grep := regexp.MustCompile("^t")
+	if r := read(t, log, Query{Lines: 1, Grep: grep}); !reflect.DeepEqual(r.Lines, []string{"three"}) {
+		t.Errorf("Expected the last matching line, got %q", r.Lines)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	log := "one\ntwo\nthr"
+
+	r := read(t, log, Query{Follow: true})
+	if !reflect.DeepEqual(r.Lines, []string{"one", "two"}) || r.Offset != 8 {
+		t.Errorf("Expected whole lines up to offset 8, got %q at %d", r.Lines, r.Offset)
+	}
+
+	log += "ee\nfour\n"
+	r = read(t, log, Query{Follow: true, Offset: r.Offset})
+	if !reflect.DeepEqual(r.Lines, []string{"three", "four"}) || r.Offset != int64(len(log)) {
+		t.Errorf("Expected the new lines, got %q at %d", r.Lines, r.Offset)
+	}
+
+	r = read(t, log, Query{Follow: true, Offset: r.Offset})
+	if len(r.Lines) != 0 || r.Offset != int64(len(log)) {
+		t.Errorf("Expected nothing new, got %q at %d", r.Lines, r.Offset)
+	}
+
+	// the log was rotated
+	r = read(t, "five\n", Query{Follow: true, Offset: r.Offset})
+	if !reflect.DeepEqual(r.Lines, []string{"five"}) {
+		t.Errorf("Expected to start again after rotation, got %q", r.Lines)
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	if n := (Query{Lines: 5}).TailLines(); n != 5 {
+		t.Errorf("Expected 5 lines, got %d", n)
+	}
+	if n := (Query{}).TailLines(); n != defaultLines {
+		t.Errorf("Expected the default %d lines, got %d", defaultLines, n)
+	}
+	if n := (Query{Lines: maxLines + 1}).TailLines(); n != maxLines {
+		t.Errorf("Expected at most %d lines, got %d", maxLines, n)
+	}
+	if n := (Query{Lines: 5, Grep: regexp.MustCompile("x")}).TailLines(); n != maxLines {
+		t.Errorf("Expected %d lines to grep, got %d", maxLines, n)
+	}
+}
@@ -48,6 +48,41 @@ func main() {
 		Handler:    handler.Delete,
 		Authoriser: service.SignInRoleAuthoriser([]string{"ADMIN"}),
 	})
+	service.Register(&service.Endpoint{
+		Name:       "report",
+		Mean:       100,
+		Upper95:    200,
+		Handler:    handler.Report,
+		Authoriser: service.SignInRoleAuthoriser([]string{"ADMIN"}),
+	})
+	service.Register(&service.Endpoint{
+		Name:       "plan",
+		Mean:       100,
+		Upper95:    500,
+		Handler:    handler.Plan,
+		Authoriser: service.SignInRoleAuthoriser([]string{"ADMIN"}),
+	})
+	service.Register(&service.Endpoint{
+		Name:       "logs",
+		Mean:       100,
+		Upper95:    500,
+		Handler:    handler.Logs,
+		Authoriser: service.SignInRoleAuthoriser([]string{"ADMIN"}),
+	})
+	service.Register(&service.Endpoint{
+		Name:       "maintenance",
+		Mean:       100,
+		Upper95:    200,
+		Handler:    handler.Maintenance,
+		Authoriser: service.SignInRoleAuthoriser([]string{"ADMIN"}),
+	})
+	service.Register(&service.Endpoint{
+		Name:       "stopguard",
+		Mean:       100,
+		Upper95:    200,
+		Handler:    handler.StopGuard,
+		Authoriser: service.SignInRoleAuthoriser([]string{"ADMIN"}),
+	})
 	service.Register(&service.Endpoint{
 		Name:       "com.HailoOSS.kernel.provisioning.restart",
 		Handler:    handler.Restart,
@@ -60,6 +95,12 @@ func main() {
 		Authoriser: service.SignInRoleAuthoriser([]string{"ADMIN"}),
 		Subscribe:  "com.HailoOSS.kernel.provisioning.restartaz",
 	})
+	service.Register(&service.Endpoint{
+		Name:       "com.HailoOSS.kernel.provisioning.changed",
+		Handler:    handler.Changed,
+		Authoriser: service.SignInRoleAuthoriser([]string{"ADMIN"}),
+		Subscribe:  "com.HailoOSS.kernel.provisioning.changed",
+	})
 
 	service.RegisterPostConnectHandler(pkgmgr.Setup)
 	service.RegisterPostConnectHandler(runner.Run)
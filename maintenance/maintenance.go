@@ -0,0 +1,203 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/event"
+	"github.com/HailoOSS/provisioning-service/fsutil"
+)
+
+const (
+	defaultFile = "/opt/hailo/var/maintenance"
+)
+
+var (
+	// file marks the host as in maintenance. It may be written by hand, and
+	// if empty pauses every service until it is removed.
+	file = defaultFile
+
+	mtx  sync.Mutex
+	last *State
+)
+
+func init() {
+	if f := os.Getenv("H2O_MAINTENANCE_FILE"); f != "" {
+		file = f
+	}
+}
+
+// State describes maintenance of this host
+type State struct {
+	// Services are paused, or every service if there are none
+	Services []string `json:",omitempty"`
+	// Until maintenance ends by itself, or never if zero
+	Until   time.Time
+	Started time.Time
+	Reason  string `json:",omitempty"`
+	User    string `json:",omitempty"`
+}
+
+// All returns whether every service is paused
+func (s *State) All() bool {
+	return len(s.Services) == 0
+}
+
+// Pauses returns whether a service should be left alone
+func (s *State) Pauses(service string) bool {
+	if s == nil {
+		return false
+	}
+	if s.All() {
+		return true
+	}
+
+	for _, name := range s.Services {
+		if name == service {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *State) expired(now time.Time) bool {
+	return !s.Until.IsZero() && !now.Before(s.Until)
+}
+
+func (s *State) String() string {
+	desc := "all services"
+	if !s.All() {
+		desc = strings.Join(s.Services, ", ")
+	}
+	if !s.Until.IsZero() {
+		desc += fmt.Sprintf(" until %s", s.Until.Format(time.RFC3339))
+	}
+	if s.User != "" {
+		desc += fmt.Sprintf(" by %s", s.User)
+	}
+	if s.Reason != "" {
+		desc += ": " + s.Reason
+	}
+	return desc
+}
+
+func (s *State) equal(o *State) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	return s.String() == o.String() && s.Started.Equal(o.Started)
+}
+
+// read returns the state in the marker file, including expired state
+func read() (*State, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{}
+	if len(strings.TrimSpace(string(b))) > 0 {
+		if err := json.Unmarshal(b, s); err != nil {
+			// still pause everything, the operator wanted something paused
+			log.Warnf("Failed to parse maintenance file %s, pausing all services: %v", file, err)
+			s = &State{}
+		}
+	}
+
+	if s.Started.IsZero() {
+		if fi, err := os.Stat(file); err == nil {
+			s.Started = fi.ModTime()
+		}
+	}
+
+	return s, nil
+}
+
+// Current returns the maintenance this host is in, or nil
+func Current() (*State, error) {
+	s, err := read()
+	if err != nil || s == nil || s.expired(time.Now()) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Check returns the maintenance this host is in, ending it once it expires
+// and publishing events when it starts or ends
+func Check() *State {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	s, err := read()
+	if err != nil {
+		log.Errorf("Failed to read maintenance file %s, keeping last state: %v", file, err)
+		return last
+	}
+
+	if s != nil && s.expired(time.Now()) {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Failed to remove expired maintenance file %s: %v", file, err)
+		}
+		s = nil
+	}
+
+	transition(s)
+	return s
+}
+
+// transition publishes events for a change of state
+func transition(s *State) {
+	if s.equal(last) {
+		return
+	}
+
+	if last != nil {
+		log.Infof("Maintenance ended of %v", last)
+		event.MaintenanceEnded(last.String())
+	}
+	if s != nil {
+		log.Infof("Maintenance started of %v", s)
+		event.MaintenanceStarted(s.String())
+	}
+
+	last = s
+}
+
+// Start puts this host in maintenance, replacing any maintenance it is in
+func Start(s *State) error {
+	if s.Started.IsZero() {
+		s.Started = time.Now()
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFile(file, b, 0644); err != nil {
+		return err
+	}
+
+	Check()
+	return nil
+}
+
+// End takes this host out of maintenance
+func End() error {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	Check()
+	return nil
+}
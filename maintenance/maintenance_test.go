@@ -0,0 +1,81 @@
+package maintenance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func withFile(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := file
+	file = filepath.Join(dir, "maintenance")
+	last = nil
+
+	return func() {
+		file = old
+		last = nil
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	defer withFile(t)()
+
+	if s := Check(); s != nil {
+		t.Fatalf("Expected no maintenance without a file, got %v", s)
+	}
+
+	if err := Start(&State{Services: []string{"com.HailoOSS.service.foo"}, Reason: "debugging"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Check()
+	if !s.Pauses("com.HailoOSS.service.foo") || s.Pauses("com.HailoOSS.service.bar") {
+		t.Errorf("Expected only foo to be paused, got %v", s)
+	}
+
+	if err := End(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := Check(); s != nil || s.Pauses("com.HailoOSS.service.foo") {
+		t.Errorf("Expected maintenance to have ended, got %v", s)
+	}
+}
+
+func TestMaintenanceMarkerFile(t *testing.T) {
+	defer withFile(t)()
+
+	// an operator touching the file pauses everything
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Check()
+	if s == nil || !s.All() || s.Started.IsZero() {
+		t.Errorf("Expected all services to be paused, got %v", s)
+	}
+}
+
+func TestMaintenanceExpiry(t *testing.T) {
+	defer withFile(t)()
+
+	if err := Start(&State{Until: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := Check(); s != nil {
+		t.Errorf("Expected expired maintenance to have ended, got %v", s)
+	}
+
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Expected expired maintenance file to be removed, got %v", err)
+	}
+}
@@ -3,6 +3,8 @@ package pkgmgr
 import (
 	"github.com/HailoOSS/provisioning-service/dao"
 	"github.com/HailoOSS/provisioning-service/goget"
+	"github.com/HailoOSS/provisioning-service/httprepo"
+	"github.com/HailoOSS/provisioning-service/localrepo"
 	"github.com/HailoOSS/provisioning-service/s3"
 	"os"
 )
@@ -22,10 +24,20 @@ type PkgMgr interface {
 	Setup() error
 }
 
+// Cleaner is implemented by package managers which keep working files that
+// can be removed to free disk space
+type Cleaner interface {
+	Clean() error
+}
+
 func init() {
 	switch os.Getenv("H2O_PACKAGE_MANAGER") {
 	case "goget":
 		Init(goget.New())
+	case "http":
+		Init(httprepo.New())
+	case "local":
+		Init(localrepo.New())
 	default:
 		Init(s3.New())
 	}
@@ -68,3 +80,12 @@ func Setup() {
 		panic("Provisioning service encountered during setup - " + err.Error())
 	}
 }
+
+// Clean removes the package manager's working files, if it has any
+func Clean() error {
+	if c, ok := defaultPkgMgr.(Cleaner); ok {
+		return c.Clean()
+	}
+
+	return nil
+}
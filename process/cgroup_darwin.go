@@ -0,0 +1,22 @@
+package process
+
+// there are no cgroups on darwin, so services run without limits
+
+func setCgroupLimits(service string, l resourceLimits) error {
+	return nil
+}
+
+func joinCgroup(job string, pid int) error {
+	return nil
+}
+
+func removeCgroup(job string) error {
+	return nil
+}
+
+func cgroupOOMKills(service string) uint64 {
+	return 0
+}
+
+// EnforceLimits does nothing on darwin
+func EnforceLimits() {}
@@ -0,0 +1,316 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	cgroupMount       = "/sys/fs/cgroup"
+	defaultCgroupRoot = cgroupMount + "/hailo.slice"
+	// period cpu.max quotas are expressed against, in microseconds
+	cgroupCPUPeriod = 100000
+)
+
+var (
+	// cgroupRoot is the cgroup v2 subtree delegated to us, which each
+	// service gets a cgroup under
+	cgroupRoot = getCgroupRoot()
+)
+
+func getCgroupRoot() string {
+	if root := os.Getenv("HAILO_CGROUP_ROOT"); root != "" {
+		return root
+	}
+
+	return defaultCgroupRoot
+}
+
+// initManagesCgroups is true when the init system puts services into cgroups
+// itself. systemd does, and applies limits from the unit.
+func initManagesCgroups() bool {
+	_, ok := initCtl.(*systemd)
+	return ok
+}
+
+// cgroupSlice is the systemd slice services are put in, when our cgroup root
+// is one
+func cgroupSlice() string {
+	if slice := filepath.Base(cgroupRoot); strings.HasSuffix(slice, ".slice") {
+		return slice
+	}
+	return ""
+}
+
+func cgroupDir(name string) string {
+	if initManagesCgroups() {
+		return filepath.Join(cgroupRoot, name+".service")
+	}
+
+	return filepath.Join(cgroupRoot, name)
+}
+
+func writeCgroupFile(dir, file, value string) error {
+	return ioutil.WriteFile(filepath.Join(dir, file), []byte(value), 0644)
+}
+
+// setCgroupLimits updates the limits of the cgroups of running instances of a
+// service. Cgroups are created as instances join them. Under systemd the
+// running units are changed, and new units get the limits from their file.
+func setCgroupLimits(service string, l resourceLimits) error {
+	if initManagesCgroups() {
+		return setUnitLimits(service, l)
+	}
+
+	var lastErr error
+	for _, dir := range instanceCgroups(service) {
+		if err := writeCgroupLimits(dir, l); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// setUnitLimits changes the limits of the running units of a service until
+// they are next started
+func setUnitLimits(service string, l resourceLimits) error {
+	running, err := initCtl.List(service)
+	if err != nil {
+		return err
+	}
+
+	cpuQuota, memoryMax := "", "infinity"
+	if quota := l.cpuQuota(); quota != "" {
+		cpuQuota = quota + "%"
+	}
+	if max := l.memoryMax(); max != "" {
+		memoryMax = max
+	}
+
+	var lastErr error
+	for _, job := range running {
+		name, version, _, err := SplitInstanceName(job)
+		if err != nil || combineNameVersion(name, version) != service {
+			continue
+		}
+
+		unitName := job + ".service"
+		if err := run("systemctl", "set-property", "--runtime", unitName, "CPUQuota="+cpuQuota, "MemoryMax="+memoryMax); err != nil {
+			lastErr = fmt.Errorf("Tried to set limits of %s: %v", unitName, err)
+		}
+	}
+	return lastErr
+}
+
+// instanceCgroups returns the cgroups of the instances of a service
+func instanceCgroups(service string) []string {
+	dirs, err := ioutil.ReadDir(cgroupRoot)
+	if err != nil {
+		return nil
+	}
+
+	var cgroups []string
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		name, version, _, err := SplitInstanceName(strings.TrimSuffix(d.Name(), ".service"))
+		if err == nil && combineNameVersion(name, version) == service {
+			cgroups = append(cgroups, filepath.Join(cgroupRoot, d.Name()))
+		}
+	}
+	return cgroups
+}
+
+func writeCgroupLimits(dir string, l resourceLimits) error {
+	cpuMax := "max"
+	if l.cpu > 0 {
+		cpuMax = strconv.FormatUint(l.cpu*cgroupCPUPeriod/1000, 10)
+	}
+	if err := writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%s %d", cpuMax, cgroupCPUPeriod)); err != nil {
+		return err
+	}
+
+	memoryMax := "max"
+	if l.memory > 0 {
+		memoryMax = strconv.FormatUint(l.memory, 10)
+	}
+	return writeCgroupFile(dir, "memory.max", memoryMax)
+}
+
+// ensureCgroup creates the cgroup of a service instance with the limits of
+// its service. Services without limits don't get one.
+func ensureCgroup(job string) (string, error) {
+	name, version, _, err := SplitInstanceName(job)
+	if err != nil {
+		return "", err
+	}
+
+	dir := cgroupDir(job)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	l := getLimits(combineNameVersion(name, version))
+	if l == (resourceLimits{}) {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(cgroupRoot, 0755); err != nil {
+		return "", err
+	}
+
+	// make the cpu and memory controllers available to our services
+	if err := writeCgroupFile(cgroupRoot, "cgroup.subtree_control", "+cpu +memory"); err != nil {
+		return "", fmt.Errorf("Unable to enable cgroup controllers under %s: %v", cgroupRoot, err)
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	return dir, writeCgroupLimits(dir, l)
+}
+
+// joinCgroup moves a process into the cgroup of its service instance, if it
+// has limits
+func joinCgroup(job string, pid int) error {
+	if initManagesCgroups() {
+		return nil
+	}
+
+	dir, err := ensureCgroup(job)
+	if err != nil || dir == "" {
+		return err
+	}
+
+	return writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// removeCgroup removes the cgroup of a stopped service instance
+func removeCgroup(job string) error {
+	if initManagesCgroups() {
+		return nil
+	}
+
+	if err := os.Remove(cgroupDir(job)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// cgroupOOMKills adds up the OOM kills in memory.events of every instance
+func cgroupOOMKills(service string) uint64 {
+	var kills uint64
+	for _, dir := range instanceCgroups(service) {
+		kills += readOOMKills(filepath.Join(dir, "memory.events"))
+	}
+	return kills
+}
+
+func readOOMKills(events string) uint64 {
+	f, err := os.Open(events)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.ParseUint(fields[1], 10, 64)
+			return n
+		}
+	}
+
+	return 0
+}
+
+// EnforceLimits moves running services into their cgroups. Services join
+// their cgroup as they start, but one created since, e.g. when limits are
+// first set, is only joined here, so this is called on every check.
+func EnforceLimits() {
+	if initManagesCgroups() {
+		return
+	}
+
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		log.Warnf("Unable to list processes: %v", err)
+		return
+	}
+
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+
+		exe, err := os.Readlink(filepath.Join("/proc", p.Name(), "exe"))
+		if err != nil {
+			continue
+		}
+		exe = strings.TrimSuffix(exe, " (deleted)")
+		if filepath.Dir(exe) != exeDir {
+			continue
+		}
+
+		name := filepath.Base(exe)
+		if getLimits(name) == (resourceLimits{}) {
+			continue
+		}
+
+		job := name + instanceSeparator + strconv.Itoa(processInstance(pid))
+		if inCgroup(pid, cgroupDir(job)) {
+			continue
+		}
+
+		if err := joinCgroup(job, pid); err != nil {
+			log.Warnf("Unable to move %s (pid %d) into its cgroup: %v", job, pid, err)
+		}
+	}
+}
+
+// inCgroup checks whether a process is in a cgroup
+func inCgroup(pid int, dir string) bool {
+	b, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return false
+	}
+
+	// cgroup v2 has a single "0::/path" line
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join(cgroupMount, strings.TrimPrefix(line, "0::")) == dir
+		}
+	}
+
+	return false
+}
+
+// processInstance reads the instance index from the environment of a process
+func processInstance(pid int) int {
+	b, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "environ"))
+	if err != nil {
+		return 0
+	}
+
+	for _, kv := range strings.Split(string(b), "\x00") {
+		if strings.HasPrefix(kv, "INSTANCE_INDEX=") {
+			instance, _ := strconv.Atoi(strings.TrimPrefix(kv, "INSTANCE_INDEX="))
+			return instance
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,69 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(root string, ctl initCtler) {
+		cgroupRoot, initCtl = root, ctl
+	}(cgroupRoot, initCtl)
+	cgroupRoot = filepath.Join(dir, "hailo.slice")
+	initCtl = newUpstart()
+
+	name := combineNameVersion("com.HailoOSS.service.foo", 20130618183200)
+	job := InstanceName("com.HailoOSS.service.foo", 20130618183200, 1)
+	if dir, err := ensureCgroup(job); err != nil || dir != "" {
+		t.Errorf("Expected no cgroup for a service without limits, got %q %v", dir, err)
+	}
+
+	defer clearLimits("com.HailoOSS.service.foo", 20130618183200, 1)
+	if err := SetLimits("com.HailoOSS.service.foo", 20130618183200, 500, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ensureCgroup(job); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{
+		"cpu.max":    "50000 100000",
+		"memory.max": "1073741824",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(cgroupDir(job), file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("Expected %s to be %q, got %q", file, expected, b)
+		}
+	}
+
+	// changed limits apply to existing cgroups
+	if err := SetLimits("com.HailoOSS.service.foo", 20130618183200, 0, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(cgroupDir(job), "cpu.max")); string(b) != "max 100000" {
+		t.Errorf("Expected cpu limit to be removed, got %q", b)
+	}
+
+	events := "low 0\nhigh 0\nmax 3\noom 2\noom_kill 2\n"
+	if err := ioutil.WriteFile(filepath.Join(cgroupDir(job), "memory.events"), []byte(events), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n := cgroupOOMKills(name); n != 2 {
+		t.Errorf("Expected 2 OOM kills, got %d", n)
+	}
+
+	if limits := (resourceLimits{cpu: 250, memory: 1 << 20}); limits.cpuQuota() != "25" || limits.memoryMax() != "1048576" {
+		t.Errorf("Expected systemd limits of 25%% and 1048576, got %s and %s", limits.cpuQuota(), limits.memoryMax())
+	}
+}
@@ -0,0 +1,134 @@
+package process
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// variables of our own environment services inherit, unless
+	// HAILO_INIT_ENV_ALLOW lists others. A trailing * matches a prefix.
+	defaultEnvAllow = "PATH,LANG,LC_*,TZ,H2O_MACHINE_CLASS"
+	hostEnvScript   = "/opt/hailo/env.sh"
+)
+
+// serviceEnv is the environment and arguments of a service
+type serviceEnv struct {
+	env  map[string]string
+	args []string
+}
+
+var (
+	envMtx      sync.RWMutex
+	serviceEnvs = make(map[string]serviceEnv)
+)
+
+// SetEnvironment sets the environment variables and command line arguments
+// of a service, which are used when it is next started
+func SetEnvironment(serviceName string, serviceVersion uint64, env map[string]string, args []string) {
+	name := combineNameVersion(serviceName, serviceVersion)
+
+	envMtx.Lock()
+	defer envMtx.Unlock()
+
+	if len(env) == 0 && len(args) == 0 {
+		delete(serviceEnvs, name)
+		return
+	}
+	serviceEnvs[name] = serviceEnv{env: env, args: args}
+}
+
+func getServiceEnv(name string) serviceEnv {
+	envMtx.RLock()
+	defer envMtx.RUnlock()
+
+	return serviceEnvs[name]
+}
+
+func copyEnv(env map[string]string) map[string]string {
+	c := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		c[k] = v
+	}
+	return c
+}
+
+// envAllowed checks a variable against the allow-list
+func envAllowed(key string, allow []string) bool {
+	for _, a := range allow {
+		if a == key || (strings.HasSuffix(a, "*") && strings.HasPrefix(key, strings.TrimSuffix(a, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// inheritedEnvironment returns the variables of our own environment services
+// may see, so they can't pick up our credentials by accident
+func inheritedEnvironment() map[string]string {
+	allowList := os.Getenv("HAILO_INIT_ENV_ALLOW")
+	if allowList == "" {
+		allowList = defaultEnvAllow
+	}
+	allow := strings.Split(allowList, ",")
+
+	env := make(map[string]string)
+	for _, val := range os.Environ() {
+		vals := strings.SplitN(val, "=", 2)
+		if len(vals) == 2 && envAllowed(vals[0], allow) {
+			env[vals[0]] = vals[1]
+		}
+	}
+	return env
+}
+
+// environList turns an environment into KEY=value pairs, sorted by key
+func environList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// shellQuote quotes a string for sh
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellExports returns a command exporting an environment, or nothing
+func shellExports(env map[string]string) string {
+	if len(env) == 0 {
+		return ""
+	}
+
+	var vars []string
+	for _, kv := range environList(env) {
+		vals := strings.SplitN(kv, "=", 2)
+		vars = append(vars, vals[0]+"="+shellQuote(vals[1]))
+	}
+	return "export " + strings.Join(vars, " ") + "; "
+}
+
+// launchCommand returns a single line of sh which starts a service with the
+// inherited environment, then the host environment from env.sh, then its own
+// environment and arguments
+func launchCommand(exePath string, inherited map[string]string, se serviceEnv) string {
+	cmd := shellExports(inherited)
+	cmd += "[ -f " + hostEnvScript + " ] && . " + hostEnvScript + "; "
+	cmd += shellExports(se.env)
+	cmd += "exec " + shellQuote(exePath)
+	for _, arg := range se.args {
+		cmd += " " + shellQuote(arg)
+	}
+	return cmd
+}
+
+// systemdQuote quotes a string as a single systemd command line argument
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$", "%", "%%")
+	return `"` + r.Replace(s) + `"`
+}
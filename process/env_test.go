@@ -0,0 +1,40 @@
+package process
+
+import (
+	"os"
+	"testing"
+)
+
+func TestInheritedEnvironment(t *testing.T) {
+	defer os.Unsetenv("HAILO_INIT_ENV_ALLOW")
+	os.Setenv("HAILO_INIT_ENV_ALLOW", "PATH,H2O_*")
+	os.Setenv("H2O_TEST_ALLOWED", "yes")
+	os.Setenv("AWS_SECRET_ACCESS_KEY_TEST", "secret")
+	defer os.Unsetenv("H2O_TEST_ALLOWED")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY_TEST")
+
+	env := inheritedEnvironment()
+	if env["H2O_TEST_ALLOWED"] != "yes" {
+		t.Error("Expected allowed variable to be inherited")
+	}
+	if _, ok := env["AWS_SECRET_ACCESS_KEY_TEST"]; ok {
+		t.Error("Expected variable which isn't allowed not to be inherited")
+	}
+}
+
+func TestLaunchCommand(t *testing.T) {
+	se := serviceEnv{
+		env:  map[string]string{"GREETING": "it's me", "B": "2"},
+		args: []string{"-port", "8080"},
+	}
+
+	cmd := launchCommand("/opt/hailo/bin/foo-1", map[string]string{"PATH": "/bin"}, se)
+	expected := `export PATH='/bin'; [ -f /opt/hailo/env.sh ] && . /opt/hailo/env.sh; export B='2' GREETING='it'\''s me'; exec '/opt/hailo/bin/foo-1' '-port' '8080'`
+	if cmd != expected {
+		t.Errorf("Expected launch command\n%s\ngot\n%s", expected, cmd)
+	}
+
+	if q := systemdQuote(`echo "$HOME" 100%`); q != `"echo \"$$HOME\" 100%%"` {
+		t.Errorf("Unexpected systemd quoting %s", q)
+	}
+}
@@ -0,0 +1,37 @@
+package process
+
+import (
+	"testing"
+)
+
+func TestSplitInstanceName(t *testing.T) {
+	for job, expected := range map[string]struct {
+		name     string
+		version  uint64
+		instance int
+	}{
+		"com.HailoOSS.service.foo-20130618183200@0":   {"com.HailoOSS.service.foo", 20130618183200, 0},
+		"com.HailoOSS.service.foo-20130618183200@3":   {"com.HailoOSS.service.foo", 20130618183200, 3},
+		"com.HailoOSS.service.foo-2-20130618183200@1": {"com.HailoOSS.service.foo-2", 20130618183200, 1},
+	} {
+		name, version, instance, err := SplitInstanceName(job)
+		if err != nil || name != expected.name || version != expected.version || instance != expected.instance {
+			t.Errorf("Expected %s to split into %v, got %s %d %d %v", job, expected, name, version, instance, err)
+		}
+
+		if n := InstanceName(name, version, instance); n != job {
+			t.Errorf("Expected instance name %s, got %s", job, n)
+		}
+	}
+
+	// jobs installed before services had instances
+	if name, version, instance, err := SplitInstanceName("com.HailoOSS.service.foo-20130618183200"); err != nil || name != "com.HailoOSS.service.foo" || version != 20130618183200 || instance != 0 {
+		t.Errorf("Expected a job without an instance to be the first instance, got %s %d %d %v", name, version, instance, err)
+	}
+
+	for _, job := range []string{"com.HailoOSS.service.foo", "com.HailoOSS.service.foo@1", "com.HailoOSS.service.foo-1@x"} {
+		if _, _, _, err := SplitInstanceName(job); err == nil {
+			t.Errorf("Expected an error splitting %s", job)
+		}
+	}
+}
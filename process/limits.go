@@ -0,0 +1,83 @@
+package process
+
+import (
+	"strconv"
+	"sync"
+
+	log "github.com/cihub/seelog"
+)
+
+// resourceLimits are the cpu and memory limits of a service. cpu is in
+// thousandths of a core and memory in bytes, 0 meaning unlimited.
+type resourceLimits struct {
+	cpu    uint64
+	memory uint64
+}
+
+var (
+	limitsMtx sync.RWMutex
+	limits    = make(map[string]resourceLimits)
+)
+
+func getLimits(name string) resourceLimits {
+	limitsMtx.RLock()
+	defer limitsMtx.RUnlock()
+
+	return limits[name]
+}
+
+// cpuQuota returns a cpu limit as a percentage of a single core
+func (l resourceLimits) cpuQuota() string {
+	if l.cpu == 0 {
+		return ""
+	}
+	return strconv.FormatUint((l.cpu+9)/10, 10)
+}
+
+func (l resourceLimits) memoryMax() string {
+	if l.memory == 0 {
+		return ""
+	}
+	return strconv.FormatUint(l.memory, 10)
+}
+
+// SetLimits sets the cpu and memory limits of a service. Limits are applied
+// to running instances straight away, and to instances as they start.
+func SetLimits(serviceName string, serviceVersion, cpu, memory uint64) error {
+	name := combineNameVersion(serviceName, serviceVersion)
+	l := resourceLimits{cpu: cpu, memory: memory}
+
+	limitsMtx.Lock()
+	current, ok := limits[name]
+	limits[name] = l
+	limitsMtx.Unlock()
+
+	if ok && current == l {
+		return nil
+	}
+
+	return setCgroupLimits(name, l)
+}
+
+// clearLimits removes the cgroup of a stopped service instance. The limits
+// of the service are forgotten once none of its instances are running.
+func clearLimits(serviceName string, serviceVersion uint64, instance int) {
+	job := InstanceName(serviceName, serviceVersion, instance)
+	if err := removeCgroup(job); err != nil {
+		log.Warnf("Failed to remove cgroup of %s: %v", job, err)
+	}
+
+	if running, err := RunningInstances(serviceName, serviceVersion); err != nil || len(running) > 0 {
+		return
+	}
+
+	limitsMtx.Lock()
+	delete(limits, combineNameVersion(serviceName, serviceVersion))
+	limitsMtx.Unlock()
+}
+
+// OOMKills returns how many times processes of a service were killed for
+// running out of memory
+func OOMKills(serviceName string, serviceVersion uint64) uint64 {
+	return cgroupOOMKills(combineNameVersion(serviceName, serviceVersion))
+}
@@ -0,0 +1,449 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// respawnLimit and respawnInterval mirror upstart's "respawn limit 10 5"
+	respawnLimit    = 10
+	respawnInterval = 5 * time.Second
+	minBackoff      = time.Second
+	maxBackoff      = time.Minute
+	killTimeout     = 5 * time.Second
+)
+
+var (
+	// ErrBackingOff is returned when starting a process which the native
+	// supervisor is holding in backoff after it respawned too often
+	ErrBackingOff = errors.New("held in backoff after respawning too often")
+)
+
+// native is an initCtler which forks and supervises the service binaries
+// itself, so no init daemon is needed
+type native struct {
+	Config config
+
+	mtx   sync.Mutex
+	procs map[string]*supervised
+}
+
+// supervised is a single service binary being kept alive by native
+type supervised struct {
+	name       string
+	script     string
+	credential *syscall.Credential
+
+	stop    chan struct{}
+	restart chan struct{}
+	done    chan struct{}
+
+	// running is set while the process is alive or being respawned, and not
+	// while it is held in backoff after respawning too often
+	mtx     sync.Mutex
+	running bool
+}
+
+func newNative() *native {
+	return &native{
+		Config: config{
+			Directory: getConfDir(defaultNativeConfDir),
+			Extension: ".sh",
+		},
+		procs: make(map[string]*supervised),
+	}
+}
+
+func (env *native) Install(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
+	templateText := `#!/bin/sh
+# Auto-generated by the provisioning service at {{.GeneratedAt}}
+# Description: {{.Description}}
+# Author:      {{.Author}}
+
+ulimit -S -n {{.NoFileSoftLimit}}
+ulimit -H -n {{.NoFileHardLimit}}
+
+{{.Launch}}
+`
+
+	tmpl, err := template.New("native").Parse(templateText)
+	if err != nil {
+		return err
+	}
+
+	return install(serviceName, serviceVersion, instance, noFileSoftLimit, noFileHardLimit, env.Config, tmpl)
+}
+
+func (env *native) List(matching string) ([]string, error) {
+	env.mtx.Lock()
+	defer env.mtx.Unlock()
+
+	processes := make([]string, 0, len(env.procs))
+	for name, s := range env.procs {
+		if !s.isRunning() {
+			continue
+		}
+		if len(matching) == 0 || strings.Contains(name, matching) {
+			processes = append(processes, name)
+		}
+	}
+	sort.Strings(processes)
+
+	return processes, nil
+}
+
+func (env *native) Start(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+
+	env.mtx.Lock()
+	defer env.mtx.Unlock()
+
+	if s, ok := env.procs[cmdName]; ok {
+		if s.isRunning() {
+			return fmt.Errorf("Tried to start %s: already running", cmdName)
+		}
+
+		// the supervisor respawns it once its backoff is over
+		return ErrBackingOff
+	}
+
+	if err := env.Install(serviceName, serviceVersion, instance, noFileSoftLimit, noFileHardLimit); err != nil {
+		return err
+	}
+
+	credential, err := getCredential()
+	if err != nil {
+		return fmt.Errorf("Tried to start %s: %v", cmdName, err)
+	}
+
+	// children inherit our limits, and an unprivileged child can only lower its
+	// hard limit, so make sure ours is high enough before forking
+	raiseNoFileLimit(getNoFileLimits(noFileSoftLimit, noFileHardLimit))
+
+	s := &supervised{
+		name:       cmdName,
+		script:     getConfPath(serviceName, serviceVersion, instance, env.Config),
+		credential: credential,
+		stop:       make(chan struct{}),
+		restart:    make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		running:    true,
+	}
+	env.procs[cmdName] = s
+	go s.run()
+
+	return nil
+}
+
+func (env *native) Stop(serviceName string, serviceVersion uint64, instance int) error {
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+
+	if !env.unsupervise(cmdName) {
+		return fmt.Errorf("Tried to stop %s: not running", cmdName)
+	}
+
+	if err := uninstall(serviceName, serviceVersion, instance, env.Config); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unsupervise stops a process and stops keeping it alive, returning whether
+// it was supervised
+func (env *native) unsupervise(cmdName string) bool {
+	env.mtx.Lock()
+	s, ok := env.procs[cmdName]
+	delete(env.procs, cmdName)
+	env.mtx.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	close(s.stop)
+	<-s.done
+	return true
+}
+
+func (env *native) Restart(serviceName string, serviceVersion uint64, instance int) error {
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+
+	env.mtx.Lock()
+	s, ok := env.procs[cmdName]
+	env.mtx.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Tried to restart %s: not running", cmdName)
+	}
+
+	select {
+	case s.restart <- struct{}{}:
+	default:
+		// a restart is already pending
+	}
+
+	return nil
+}
+
+// Uninstall removes the config of a service. A process held in backoff isn't
+// listed as running, so the runner won't stop it when it's deprovisioned; it
+// is stopped along with its config instead.
+func (env *native) Uninstall(serviceName string, serviceVersion uint64, instance int) error {
+	env.unsupervise(InstanceName(serviceName, serviceVersion, instance))
+	return uninstall(serviceName, serviceVersion, instance, env.Config)
+}
+
+func (env *native) Installed(matching string) ([]string, error) {
+	return listInstalled(env.Config, matching)
+}
+
+// run keeps the process alive until stopped. Like upstart it respawns
+// immediately, but once the respawn limit is hit it backs off exponentially
+// rather than giving up.
+func (s *supervised) run() {
+	defer close(s.done)
+
+	// the parent death signal is sent when the thread which forked the
+	// process exits, not the whole of us, so keep forking from one thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var respawns []time.Time
+	var backoff time.Duration
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		cmd, err := s.spawn()
+		s.setRunning(err == nil)
+		if err != nil {
+			log.Errorf("[supervisor] Failed to start %s: %v", s.name, err)
+
+			// don't spin while it can't be started at all
+			select {
+			case <-s.stop:
+				return
+			case <-s.restart:
+				respawns, backoff = nil, 0
+				continue
+			case <-time.After(minBackoff):
+			}
+		} else {
+			exited := make(chan error, 1)
+			go func() {
+				exited <- cmd.Wait()
+			}()
+
+			select {
+			case <-s.stop:
+				s.terminate(cmd, exited)
+				return
+			case <-s.restart:
+				log.Infof("[supervisor] Restarting %s", s.name)
+				s.terminate(cmd, exited)
+				respawns, backoff = nil, 0
+				continue
+			case err := <-exited:
+				log.Warnf("[supervisor] %s exited: %v", s.name, err)
+			}
+		}
+
+		now := time.Now()
+		respawns = append(respawnsSince(respawns, now.Add(-respawnInterval)), now)
+		if len(respawns) <= respawnLimit {
+			backoff = 0
+			continue
+		}
+
+		if backoff *= 2; backoff < minBackoff {
+			backoff = minBackoff
+		} else if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		log.Warnf("[supervisor] %s respawned more than %d times in %v, backing off for %v", s.name, respawnLimit, respawnInterval, backoff)
+		s.setRunning(false)
+
+		select {
+		case <-s.stop:
+			return
+		case <-s.restart:
+			respawns, backoff = nil, 0
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (s *supervised) setRunning(running bool) {
+	s.mtx.Lock()
+	s.running = running
+	s.mtx.Unlock()
+}
+
+func (s *supervised) isRunning() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.running
+}
+
+// spawn starts the process in its own process group, with console and error
+// output appended to the service logs
+func (s *supervised) spawn() (*exec.Cmd, error) {
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, err
+	}
+
+	stdout, err := s.openLog(path.Join(logDir, s.name+"-console.log"))
+	if err != nil {
+		return nil, err
+	}
+	defer stdout.Close()
+
+	stderr, err := s.openLog(path.Join(logDir, s.name+"-error.log"))
+	if err != nil {
+		return nil, err
+	}
+	defer stderr.Close()
+
+	cmd := exec.Command("/bin/sh", s.script)
+	cmd.Env = environList(inheritedEnvironment())
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Credential: s.credential,
+	}
+	setDeathSignal(cmd.SysProcAttr)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	if err := joinCgroup(s.name, cmd.Process.Pid); err != nil {
+		log.Warnf("[supervisor] Failed to move %s into its cgroup: %v", s.name, err)
+	}
+
+	return cmd, nil
+}
+
+func (s *supervised) openLog(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.credential != nil {
+		if err := f.Chown(int(s.credential.Uid), int(s.credential.Gid)); err != nil {
+			log.Warnf("[supervisor] Failed to chown %s: %v", name, err)
+		}
+	}
+
+	return f, nil
+}
+
+// terminate sends SIGTERM to the process group, then SIGKILL if it has not
+// exited within killTimeout
+func (s *supervised) terminate(cmd *exec.Cmd, exited chan error) {
+	pgid := -cmd.Process.Pid
+	if err := syscall.Kill(pgid, syscall.SIGTERM); err != nil {
+		log.Warnf("[supervisor] Failed to send SIGTERM to %s: %v", s.name, err)
+	}
+
+	select {
+	case <-exited:
+		return
+	case <-time.After(killTimeout):
+	}
+
+	log.Warnf("[supervisor] %s did not exit within %v, killing", s.name, killTimeout)
+	if err := syscall.Kill(pgid, syscall.SIGKILL); err != nil {
+		log.Warnf("[supervisor] Failed to send SIGKILL to %s: %v", s.name, err)
+	}
+	<-exited
+}
+
+// respawnsSince drops respawn times before the given time
+func respawnsSince(respawns []time.Time, since time.Time) []time.Time {
+	for i, t := range respawns {
+		if t.After(since) {
+			return respawns[i:]
+		}
+	}
+
+	return respawns[:0]
+}
+
+// getCredential returns the user and group to run services as. We can only
+// switch user when running as root, otherwise services run as ourselves.
+func getCredential() (*syscall.Credential, error) {
+	if os.Geteuid() != 0 {
+		return nil, nil
+	}
+
+	runAsUser, runAsGroup := getRunAs()
+
+	u, err := user.Lookup(runAsUser)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := user.LookupGroup(runAsGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+// raiseNoFileLimit raises our own hard nofile limit if it is below what a
+// service asks for
+func raiseNoFileLimit(soft, hard uint64) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		log.Warnf("[supervisor] Failed to get nofile limit: %v", err)
+		return
+	}
+
+	if soft > hard {
+		hard = soft
+	}
+
+	if hard <= uint64(rlimit.Max) {
+		return
+	}
+
+	rlimit.Max = hard
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		log.Warnf("[supervisor] Failed to raise nofile limit to %d: %v", hard, err)
+	}
+}
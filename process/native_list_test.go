@@ -0,0 +1,29 @@
+package process
+
+import (
+	"testing"
+)
+
+func TestNativeListSkipsBackoff(t *testing.T) {
+	env := newNative()
+	env.procs["com.HailoOSS.service.up-1@0"] = &supervised{running: true}
+	backingOff := &supervised{restart: make(chan struct{}, 1)}
+	env.procs["com.HailoOSS.service.down-1@0"] = backingOff
+
+	running, err := env.List("com.HailoOSS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running) != 1 || running[0] != "com.HailoOSS.service.up-1@0" {
+		t.Errorf("Expected only the running process to be listed, got %v", running)
+	}
+
+	if err := env.Start("com.HailoOSS.service.down", 1, 0, 1024, 4096); err != ErrBackingOff {
+		t.Fatalf("Expected starting a process held in backoff to be refused, got %v", err)
+	}
+	select {
+	case <-backingOff.restart:
+		t.Error("Expected the process held in backoff to be left to its backoff")
+	default:
+	}
+}
@@ -0,0 +1,74 @@
+// +build integration
+
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNativeStartStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// run as ourselves in case we are root
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("HAILO_INIT_RUNASUSER", u.Username)
+	os.Setenv("HAILO_INIT_RUNASGROUP", g.Name)
+
+	exeDir, logDir = path.Join(dir, "bin"), path.Join(dir, "log")
+	env := newNative()
+	env.Config.Directory = path.Join(dir, "run")
+
+	filename := path.Join(exeDir, "com.HailoOSS.service.provisioning.testnative-20130102030405")
+	if err := os.MkdirAll(exeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, []byte("#!/bin/sh\necho started\nsleep 1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.Start("com.HailoOSS.service.provisioning.testnative", 20130102030405, 0, 1024, 4096); err != nil {
+		t.Fatal("Error testing Start():", err)
+	}
+
+	running, _ := env.List("com.HailoOSS.service.provisioning.testnative")
+	if len(running) != 1 {
+		t.Error("Expecting our made up provisioned service to be running")
+	}
+
+	// let it exit and respawn at least once
+	time.Sleep(time.Second * 2)
+
+	if err := env.Stop("com.HailoOSS.service.provisioning.testnative", 20130102030405, 0); err != nil {
+		t.Error("Error testing Stop():", err)
+	}
+
+	running, _ = env.List("com.HailoOSS.service.provisioning.testnative")
+	if len(running) != 0 {
+		t.Error("Not expecting our made up provisioned service to be running")
+	}
+
+	b, err := ioutil.ReadFile(path.Join(logDir, "com.HailoOSS.service.provisioning.testnative-20130102030405@0-console.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "started") < 2 {
+		t.Errorf("Expecting the service to have been respawned, console log: %q", b)
+	}
+}
@@ -8,30 +8,45 @@ import (
 	"os/exec"
 	"path"
 	"strings"
+	"syscall"
 	"text/template"
 )
 
 type darwin platform
 
 var (
-	defaultConfDir = path.Join(os.Getenv("HOME"), "/Library/LaunchAgents")
+	defaultConfDir       = path.Join(os.Getenv("HOME"), "/Library/LaunchAgents")
+	defaultNativeConfDir = path.Join(os.Getenv("HOME"), "/tmp/hailo/run")
+	logDir               = "/tmp"
 )
 
 func init() {
 	exeDir = path.Join(os.Getenv("HOME"), "/tmp/hailo/bin")
 }
 
-func newPlatform() *darwin {
+// newPlatform uses launchd unless HAILO_INIT_SYSTEM is set to "native"
+func newPlatform() initCtler {
+	if os.Getenv("HAILO_INIT_SYSTEM") == "native" {
+		return newNative()
+	}
+
+	return newLaunchd()
+}
+
+// setDeathSignal is a no-op as darwin has no parent death signal
+func setDeathSignal(attr *syscall.SysProcAttr) {}
+
+func newLaunchd() *darwin {
 	return &darwin{
 		InitCmd: "launchctl",
 		Config: config{
-			Directory: getConfDir(),
+			Directory: getConfDir(defaultConfDir),
 			Extension: ".plist",
 		},
 	}
 }
 
-func (env *darwin) Install(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimit uint64) error {
+func (env *darwin) Install(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
 	templateText := `
 <?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
@@ -53,7 +68,7 @@ func (env *darwin) Install(serviceName string, serviceVersion, noFileSoftLimit,
       <dict>
       {{range $key, $val := .Environment}}
         <key>{{$key}}</key>
-        <string>{{$val}}</string>
+        <string>{{html $val}}</string>
       {{end}}
       </dict>
     {{end}}
@@ -64,8 +79,13 @@ func (env *darwin) Install(serviceName string, serviceVersion, noFileSoftLimit,
     <key>GroupName</key>
     <string>{{.RunAsGroup}}</string>
 
-    <key>Program</key>
-    <string>{{.ProcessName}}</string>
+    <key>ProgramArguments</key>
+    <array>
+      <string>{{.ProcessName}}</string>
+      {{range .Args}}
+      <string>{{html .}}</string>
+      {{end}}
+    </array>
 
     <key>StandardOutPath</key>
     <string>/tmp/{{.Description}}-console.log</string>
@@ -80,7 +100,7 @@ func (env *darwin) Install(serviceName string, serviceVersion, noFileSoftLimit,
 		return err
 	}
 
-	return install(serviceName, serviceVersion, noFileSoftLimit, noFileHardLimit, env.Config, tmpl)
+	return install(serviceName, serviceVersion, instance, noFileSoftLimit, noFileHardLimit, env.Config, tmpl)
 }
 
 func (env *darwin) List(matching string) ([]string, error) {
@@ -105,12 +125,12 @@ func (env *darwin) List(matching string) ([]string, error) {
 	return processes, nil
 }
 
-func (env *darwin) Start(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimit uint64) error {
-	if err := env.Install(serviceName, serviceVersion, noFileSoftLimit, noFileHardLimit); err != nil {
+func (env *darwin) Start(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
+	if err := env.Install(serviceName, serviceVersion, instance, noFileSoftLimit, noFileHardLimit); err != nil {
 		return err
 	}
-	cmdName := combineNameVersion(serviceName, serviceVersion)
-	confPath := getConfPath(serviceName, serviceVersion, env.Config)
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+	confPath := getConfPath(serviceName, serviceVersion, instance, env.Config)
 	if err := run(env.InitCmd, "load", confPath); err != nil {
 		return fmt.Errorf("Tried to load %s: %v", cmdName, err)
 	}
@@ -121,9 +141,9 @@ func (env *darwin) Start(serviceName string, serviceVersion, noFileSoftLimit, no
 	return nil
 }
 
-func (env *darwin) Stop(serviceName string, serviceVersion uint64) error {
-	cmdName := combineNameVersion(serviceName, serviceVersion)
-	confPath := getConfPath(serviceName, serviceVersion, env.Config)
+func (env *darwin) Stop(serviceName string, serviceVersion uint64, instance int) error {
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+	confPath := getConfPath(serviceName, serviceVersion, instance, env.Config)
 	if err := run(env.InitCmd, "stop", cmdName); err != nil {
 		return fmt.Errorf("Tried to stop %s: %v", cmdName, err)
 	}
@@ -132,25 +152,29 @@ func (env *darwin) Stop(serviceName string, serviceVersion uint64) error {
 		return fmt.Errorf("Tried to unload %s: %v", cmdName, err)
 	}
 
-	if err := env.Uninstall(serviceName, serviceVersion); err != nil {
+	if err := env.Uninstall(serviceName, serviceVersion, instance); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (env *darwin) Restart(serviceName string, serviceVersion uint64) error {
+func (env *darwin) Restart(serviceName string, serviceVersion uint64, instance int) error {
 	// launchctl does not support restart so stop and start.
-	if err := env.Stop(serviceName, serviceVersion); err != nil {
+	if err := env.Stop(serviceName, serviceVersion, instance); err != nil {
 		return err
 	}
 
-	if err := env.Start(serviceName, serviceVersion, 1024, 1024); err != nil {
+	if err := env.Start(serviceName, serviceVersion, instance, 1024, 1024); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (env *darwin) Uninstall(serviceName string, serviceVersion uint64) error {
-	return uninstall(serviceName, serviceVersion, env.Config)
+func (env *darwin) Uninstall(serviceName string, serviceVersion uint64, instance int) error {
+	return uninstall(serviceName, serviceVersion, instance, env.Config)
+}
+
+func (env *darwin) Installed(matching string) ([]string, error) {
+	return listInstalled(env.Config, matching)
 }
@@ -4,28 +4,77 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/template"
+
+	log "github.com/cihub/seelog"
 )
 
 type linux platform
 
 var (
-	defaultConfDir = "/etc/init"
+	defaultConfDir       = "/etc/init"
+	defaultNativeConfDir = "/opt/hailo/var/run"
+	logDir               = "/opt/hailo/var/log"
 )
 
-func newPlatform() *linux {
+// newPlatform picks the init system to drive. HAILO_INIT_SYSTEM may be set to
+// "upstart", "systemd" or "native", otherwise we use systemd if it is running
+// as PID 1.
+func newPlatform() initCtler {
+	switch initSystem := os.Getenv("HAILO_INIT_SYSTEM"); initSystem {
+	case "systemd":
+		return newSystemd()
+	case "upstart":
+		return newUpstart()
+	case "native":
+		return newNative()
+	case "":
+	default:
+		log.Warnf("Unknown HAILO_INIT_SYSTEM %q, detecting init system", initSystem)
+	}
+
+	if isSystemdRunning() {
+		return newSystemd()
+	}
+
+	return newUpstart()
+}
+
+// isSystemdRunning checks whether systemd is PID 1
+func isSystemdRunning() bool {
+	b, err := ioutil.ReadFile("/proc/1/comm")
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(b)) == "systemd"
+}
+
+// setDeathSignal makes supervised processes die with us, so they are never
+// orphaned outside of our supervision
+func setDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGTERM
+}
+
+func newUpstart() *linux {
 	return &linux{
 		InitCmd: "initctl",
 		Config: config{
-			Directory: getConfDir(),
+			Directory: getConfDir(defaultConfDir),
 			Extension: ".conf",
 		},
 	}
 }
 
-func (env *linux) Install(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimit uint64) error {
+// Install writes the job of a service, which every instance is started from
+// with its index in INSTANCE_INDEX
+func (env *linux) Install(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
 	templateText := `
 # Auto-generated by the provisioning service at {{.GeneratedAt}}
 
@@ -35,25 +84,36 @@ author      "{{.Author}}"
 start on filesystem or runlevel [2345]
 stop on runlevel [!2345]
 
-setuid {{.RunAsUser}}
-setgid {{.RunAsGroup}}
+instance $INSTANCE_INDEX
 
+{{if or .CPUQuota .MemoryMax}}# joins the cgroup of its instance as root, then runs as {{.RunAsUser}}
 script
-  [ -f /opt/hailo/env.sh ] && . /opt/hailo/env.sh
-  exec {{.ProcessName}} 1>>/opt/hailo/var/log/{{.Description}}-console.log 2>>/opt/hailo/var/log/{{.Description}}-error.log
+  echo $$ > {{cgroupDir .LogName}}/cgroup.procs || true
+  exec chroot --userspec={{.RunAsUser}}:{{.RunAsGroup}} / /bin/sh -c {{printf "%s 1>>/opt/hailo/var/log/%s-console.log 2>>/opt/hailo/var/log/%s-error.log" .Launch .LogName .LogName | shellQuote}}
 end script
+{{else}}setuid {{.RunAsUser}}
+setgid {{.RunAsGroup}}
 
+script
+  {{.Launch}} 1>>/opt/hailo/var/log/{{.LogName}}-console.log 2>>/opt/hailo/var/log/{{.LogName}}-error.log
+end script
+{{end}}
 limit nofile {{.NoFileSoftLimit}} {{.NoFileHardLimit}}
 
 respawn
 respawn limit 10 5`
 
-	tmpl, err := template.New("upstart").Parse(templateText)
+	tmpl, err := template.New("upstart").Funcs(template.FuncMap{"cgroupDir": cgroupDir, "shellQuote": shellQuote}).Parse(templateText)
 	if err != nil {
 		return err
 	}
 
-	return install(serviceName, serviceVersion, noFileSoftLimit, noFileHardLimit, env.Config, tmpl)
+	return install(serviceName, serviceVersion, anyInstance, noFileSoftLimit, noFileHardLimit, env.Config, tmpl)
+}
+
+// instanceArgs are the initctl arguments naming an instance of a job
+func instanceArgs(serviceName string, serviceVersion uint64, instance int) []string {
+	return []string{combineNameVersion(serviceName, serviceVersion), "INSTANCE_INDEX=" + strconv.Itoa(instance)}
 }
 
 func (env *linux) List(matching string) ([]string, error) {
@@ -68,9 +128,13 @@ func (env *linux) List(matching string) ([]string, error) {
 	scanner := bufio.NewScanner(bytes.NewReader(out.Bytes()))
 	processes := make([]string, 0)
 	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, " ")
-		if parts[1] == "start/running," && (len(matching) == 0 || strings.Contains(parts[0], matching)) {
+		// instances are listed as "<job> (<instance>) start/running, process <pid>"
+		parts := strings.Fields(scanner.Text())
+		if len(parts) > 2 && strings.HasPrefix(parts[1], "(") {
+			parts[0] += instanceSeparator + strings.Trim(parts[1], "()")
+			parts = append(parts[:1], parts[2:]...)
+		}
+		if len(parts) > 1 && parts[1] == "start/running," && (len(matching) == 0 || strings.Contains(parts[0], matching)) {
 			processes = append(processes, parts[0])
 		}
 	}
@@ -78,41 +142,56 @@ func (env *linux) List(matching string) ([]string, error) {
 	return processes, nil
 }
 
-func (env *linux) Start(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimit uint64) error {
-	if err := env.Install(serviceName, serviceVersion, noFileSoftLimit, noFileHardLimit); err != nil {
+func (env *linux) Start(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
+	if err := env.Install(serviceName, serviceVersion, instance, noFileSoftLimit, noFileHardLimit); err != nil {
 		return err
 	}
 
-	cmdName := combineNameVersion(serviceName, serviceVersion)
-	if err := run(env.InitCmd, "start", cmdName); err != nil {
+	// the job joins the cgroup as it starts
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+	if _, err := ensureCgroup(cmdName); err != nil {
+		log.Warnf("Unable to create cgroup of %s, it will be moved into it later: %v", cmdName, err)
+	}
+
+	if err := run(env.InitCmd, append([]string{"start"}, instanceArgs(serviceName, serviceVersion, instance)...)...); err != nil {
 		return fmt.Errorf("Tried to start %s: %v", cmdName, err)
 	}
 
 	return nil
 }
 
-func (env *linux) Stop(serviceName string, serviceVersion uint64) error {
-	cmdName := combineNameVersion(serviceName, serviceVersion)
-	if err := run(env.InitCmd, "stop", cmdName); err != nil {
+func (env *linux) Stop(serviceName string, serviceVersion uint64, instance int) error {
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+	if err := run(env.InitCmd, append([]string{"stop"}, instanceArgs(serviceName, serviceVersion, instance)...)...); err != nil {
 		return fmt.Errorf("Tried to stop %s: %v", cmdName, err)
 	}
 
-	if err := env.Uninstall(serviceName, serviceVersion); err != nil {
+	if err := env.Uninstall(serviceName, serviceVersion, instance); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (env *linux) Restart(serviceName string, serviceVersion uint64) error {
-	cmdName := combineNameVersion(serviceName, serviceVersion)
-	if err := run(env.InitCmd, "restart", cmdName); err != nil {
+func (env *linux) Restart(serviceName string, serviceVersion uint64, instance int) error {
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+	if err := run(env.InitCmd, append([]string{"restart"}, instanceArgs(serviceName, serviceVersion, instance)...)...); err != nil {
 		return fmt.Errorf("Tried to restart %s: %v", cmdName, err)
 	}
 
 	return nil
 }
 
-func (env *linux) Uninstall(serviceName string, serviceVersion uint64) error {
-	return uninstall(serviceName, serviceVersion, env.Config)
+// Uninstall removes the job of a service once none of its instances are
+// running
+func (env *linux) Uninstall(serviceName string, serviceVersion uint64, instance int) error {
+	if running, err := RunningInstances(serviceName, serviceVersion); err != nil || len(running) > 0 {
+		return err
+	}
+
+	return uninstall(serviceName, serviceVersion, anyInstance, env.Config)
+}
+
+func (env *linux) Installed(matching string) ([]string, error) {
+	return listInstalled(env.Config, matching)
 }
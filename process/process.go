@@ -6,6 +6,7 @@ import (
 	log "github.com/cihub/seelog"
 	"github.com/HailoOSS/platform/util"
 	dao "github.com/HailoOSS/provisioning-service/dao"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"os/exec"
@@ -13,6 +14,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/template"
 	"time"
 )
@@ -21,6 +23,12 @@ const (
 	osName       = runtime.GOOS
 	defaultUser  = "hailosvc"
 	defaultGroup = "hailosvc"
+	// instanceSeparator comes before the index in the job name of an
+	// instance. It can't appear in service names, unlike a dash.
+	instanceSeparator = "@"
+	// anyInstance installs an init config shared by every instance of a
+	// service, which init tells the index of the instance it starts
+	anyInstance = -1
 )
 
 var (
@@ -28,18 +36,25 @@ var (
 	exeDir  = "/opt/hailo/bin" // where we store downloaded executable files
 )
 
+// initCtler drives an init system. Services may run several instances, each
+// with its own job, identified by an index from 0. Init systems which can
+// start instances of a job share one init config between them.
 type initCtler interface {
 	List(string) ([]string, error)
-	Install(string, uint64, uint64, uint64) error
-	Start(string, uint64, uint64, uint64) error
-	Stop(string, uint64) error
-	Restart(string, uint64) error
-	Uninstall(string, uint64) error
+	Install(string, uint64, int, uint64, uint64) error
+	Start(string, uint64, int, uint64, uint64) error
+	Stop(string, uint64, int) error
+	Restart(string, uint64, int) error
+	Uninstall(string, uint64, int) error
+	Installed(string) ([]string, error)
 }
 
 type config struct {
 	Directory string
 	Extension string
+	// TemplateSuffix is added to the build name of an init config shared by
+	// every instance, e.g. the @ of systemd template units
+	TemplateSuffix string
 }
 
 type platform struct {
@@ -51,25 +66,52 @@ func combineNameVersion(serviceName string, serviceVersion uint64) string {
 	return serviceName + "-" + strconv.Itoa(int(serviceVersion))
 }
 
-func getConfDir() string {
-	if dir := os.Getenv("HAILO_INIT_DIR"); dir != "" {
-		return dir
+// InstanceName is the job name of an instance of a service,
+// <service>-<version>@<instance>, which is also the name of a systemd template
+// unit instance
+func InstanceName(serviceName string, serviceVersion uint64, instance int) string {
+	return combineNameVersion(serviceName, serviceVersion) + instanceSeparator + strconv.Itoa(instance)
+}
+
+// SplitInstanceName splits a job name into service name, version and
+// instance index. Jobs named after the service alone, which were installed
+// before services had instances, are the first instance.
+func SplitInstanceName(name string) (string, uint64, int, error) {
+	instance := 0
+	if i := strings.LastIndex(name, instanceSeparator); i != -1 {
+		n, err := strconv.Atoi(name[i+1:])
+		if err != nil || n < 0 {
+			return "", 0, 0, fmt.Errorf("Invalid instance in %q", name)
+		}
+		name, instance = name[:i], n
+	}
+
+	i := strings.LastIndex(name, "-")
+	if i == -1 {
+		return "", 0, 0, fmt.Errorf("No version in %q", name)
 	}
 
-	return defaultConfDir
+	version, err := strconv.ParseUint(name[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("Invalid version in %q: %v", name, err)
+	}
+
+	return name[:i], version, instance, nil
 }
 
-func getConfPath(serviceName string, serviceVersion uint64, conf config) string {
-	return path.Join(conf.Directory, combineNameVersion(serviceName, serviceVersion)+conf.Extension)
+func getConfDir(defaultDir string) string {
+	if dir := os.Getenv("HAILO_INIT_DIR"); dir != "" {
+		return dir
+	}
+
+	return defaultDir
 }
 
-func getEnvironment() map[string]string {
-	env := make(map[string]string)
-	for _, val := range os.Environ() {
-		vals := strings.SplitN(val, "=", 2)
-		env[vals[0]] = vals[1]
+func getConfPath(serviceName string, serviceVersion uint64, instance int, conf config) string {
+	if instance == anyInstance {
+		return path.Join(conf.Directory, combineNameVersion(serviceName, serviceVersion)+conf.TemplateSuffix+conf.Extension)
 	}
-	return env
+	return path.Join(conf.Directory, InstanceName(serviceName, serviceVersion, instance)+conf.Extension)
 }
 
 // getExePath() returns a string containing the path for this provisioned
@@ -102,20 +144,58 @@ func ExePath(ps *dao.ProvisionedService) string {
 	return getExePath(ps.ServiceName, ps.ServiceVersion)
 }
 
-func Install(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimit uint64) error {
-	return initCtl.Install(serviceName, serviceVersion, noFileSoftLimit, noFileHardLimit)
+func Install(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
+	return initCtl.Install(serviceName, serviceVersion, instance, noFileSoftLimit, noFileHardLimit)
+}
+
+func Uninstall(serviceName string, serviceVersion uint64, instance int) error {
+	return initCtl.Uninstall(serviceName, serviceVersion, instance)
 }
 
-func Uninstall(serviceName string, serviceVersion uint64) error {
-	return initCtl.Uninstall(serviceName, serviceVersion)
+// ListInstalled returns the names of services with an init config installed,
+// whether or not they are running
+func ListInstalled(matching string) ([]string, error) {
+	return initCtl.Installed(matching)
 }
 
-func Start(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimit uint64) error {
-	return initCtl.Start(serviceName, serviceVersion, noFileSoftLimit, noFileHardLimit)
+// LogPath returns the path of the console or error log of an instance of a
+// service
+func LogPath(serviceName string, serviceVersion uint64, instance int, stream string) string {
+	return path.Join(logDir, InstanceName(serviceName, serviceVersion, instance)+"-"+stream+".log")
 }
 
-func Stop(serviceName string, serviceVersion uint64) error {
-	return initCtl.Stop(serviceName, serviceVersion)
+// ExeDir returns the directory downloaded executables are stored in
+func ExeDir() string {
+	return exeDir
+}
+
+func Start(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
+	return initCtl.Start(serviceName, serviceVersion, instance, noFileSoftLimit, noFileHardLimit)
+}
+
+func Stop(serviceName string, serviceVersion uint64, instance int) error {
+	if err := initCtl.Stop(serviceName, serviceVersion, instance); err != nil {
+		return err
+	}
+
+	clearLimits(serviceName, serviceVersion, instance)
+	return nil
+}
+
+// restartInstances restarts every running instance of a service
+func restartInstances(serviceName string, serviceVersion uint64) error {
+	instances, err := RunningInstances(serviceName, serviceVersion)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, instance := range instances {
+		if err := initCtl.Restart(serviceName, serviceVersion, instance); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
 }
 
 func RestartAZ(azName string) error {
@@ -135,11 +215,17 @@ func RestartAZ(azName string) error {
 	var lastErr error
 	for _, p := range provisionedServices {
 		time.Sleep(time.Duration(rand.Int63n(5)) * time.Second) // jitter 5 second to reduce thundering herd
-		if thisErr := initCtl.Restart(p.ServiceName, p.ServiceVersion); thisErr != nil {
+		if thisErr := restartInstances(p.ServiceName, p.ServiceVersion); thisErr != nil {
 			log.Errorf("Error restarting service %s", thisErr)
 			lastErr = thisErr
 		}
 	}
+	// natively supervised services die with us, so exiting would stop
+	// every one we just restarted
+	if _, ok := initCtl.(*native); ok {
+		log.Critical("Restart AZ finished")
+		return lastErr
+	}
 	log.Critical("Restart AZ finished. Committing suicide.")
 	os.Exit(0)
 	return lastErr
@@ -157,37 +243,60 @@ func Restart(serviceName string, serviceVersion uint64, azName string) error {
 	}
 	// add some random jitter 0-60 seconds
 	time.Sleep(time.Duration(rand.Int63n(60)) * time.Second)
-	return initCtl.Restart(serviceName, serviceVersion)
+	return restartInstances(serviceName, serviceVersion)
 }
 
 func ListRunning(matching string) ([]string, error) {
 	return initCtl.List(matching)
 }
 
-func CachedCountRunningInstances(serviceName string, serviceVersion uint64, processes []string) int {
-	instance := combineNameVersion(serviceName, serviceVersion)
-	running := 0
+// CachedRunningInstances returns the indexes of the running instances of a
+// service, from a list of running processes
+func CachedRunningInstances(serviceName string, serviceVersion uint64, processes []string) []int {
+	var instances []int
 	for _, process := range processes {
-		if instance == process {
-			running++
+		name, version, instance, err := SplitInstanceName(path.Base(process))
+		if err == nil && name == serviceName && version == serviceVersion {
+			instances = append(instances, instance)
 		}
 	}
-	return running
+	return instances
 }
 
-func CountRunningInstances(serviceName string, serviceVersion uint64) (int, error) {
+// RunningInstances returns the indexes of the running instances of a service
+func RunningInstances(serviceName string, serviceVersion uint64) ([]int, error) {
 	processes, err := ListRunning(combineNameVersion(serviceName, serviceVersion))
+	if err != nil {
+		return nil, err
+	}
+	return CachedRunningInstances(serviceName, serviceVersion, processes), nil
+}
+
+func CachedCountRunningInstances(serviceName string, serviceVersion uint64, processes []string) int {
+	return len(CachedRunningInstances(serviceName, serviceVersion, processes))
+}
+
+func CountRunningInstances(serviceName string, serviceVersion uint64) (int, error) {
+	instances, err := RunningInstances(serviceName, serviceVersion)
 	if err != nil {
 		return -1, err
 	}
-	return len(processes), nil
+	return len(instances), nil
 }
 
-func install(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimit uint64, conf config, tmpl *template.Template) error {
+// install writes the init config of an instance of a service, or the one
+// shared by every instance. Shared configs name the instance with the shell
+// variable $INSTANCE_INDEX, which init must set.
+func install(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64, conf config, tmpl *template.Template) error {
 
-	cmdName := combineNameVersion(serviceName, serviceVersion)
+	cmdName := InstanceName(serviceName, serviceVersion, instance)
+	logName := cmdName
+	if instance == anyInstance {
+		cmdName = combineNameVersion(serviceName, serviceVersion)
+		logName = cmdName + instanceSeparator + "$INSTANCE_INDEX"
+	}
 	exePath := getExePath(serviceName, serviceVersion)
-	confPath := getConfPath(serviceName, serviceVersion, conf)
+	confPath := getConfPath(serviceName, serviceVersion, instance, conf)
 
 	if _, err := os.Stat(exePath); os.IsNotExist(err) {
 		return fmt.Errorf("Unable to install, binary does not exist: %v", exePath)
@@ -213,29 +322,30 @@ func install(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimi
 	}
 	defer file.Close()
 
-	user := os.Getenv("HAILO_INIT_RUNASUSER")
-	group := os.Getenv("HAILO_INIT_RUNASGROUP")
+	user, group := getRunAs()
+	noFileSoftLimit, noFileHardLimit = getNoFileLimits(noFileSoftLimit, noFileHardLimit)
+	limits := getLimits(combineNameVersion(serviceName, serviceVersion))
+	inherited := inheritedEnvironment()
+	se := getServiceEnv(combineNameVersion(serviceName, serviceVersion))
 
-	if user == "" {
-		user = defaultUser
-		log.Info("HAILO_INIT_RUNASUSER was not set - defaulting to " + user)
+	// instances can use their index to shard work
+	if instance != anyInstance {
+		se.env = copyEnv(se.env)
+		se.env["INSTANCE_INDEX"] = strconv.Itoa(instance)
 	}
 
-	if group == "" {
-		group = defaultGroup
-		log.Info("HAILO_INIT_RUNASGROUP was not set - defaulting to " + group)
+	// the environment of services started directly, without a shell
+	environment := make(map[string]string)
+	for k, v := range inherited {
+		environment[k] = v
 	}
-
-	if noFileSoftLimit < 1024 {
-		noFileSoftLimit = 1024
-	}
-
-	if noFileHardLimit < 1024 {
-		noFileHardLimit = 4096
+	for k, v := range se.env {
+		environment[k] = v
 	}
 
 	params := &struct {
 		Description     string
+		LogName         string
 		Author          string
 		ProcessName     string
 		GeneratedAt     string
@@ -243,9 +353,14 @@ func install(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimi
 		RunAsGroup      string
 		NoFileSoftLimit string
 		NoFileHardLimit string
+		CPUQuota        string
+		MemoryMax       string
 		Environment     map[string]string
+		Args            []string
+		Launch          string
 	}{
 		cmdName,
+		logName,
 		"com.HailoOSS.service.provisioning.create",
 		exePath,
 		time.Now().String(),
@@ -253,7 +368,11 @@ func install(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimi
 		group,
 		strconv.Itoa(int(noFileSoftLimit)),
 		strconv.Itoa(int(noFileHardLimit)),
-		getEnvironment(),
+		limits.cpuQuota(),
+		limits.memoryMax(),
+		environment,
+		se.args,
+		launchCommand(exePath, inherited, se),
 	}
 
 	err = tmpl.Execute(file, params)
@@ -263,8 +382,56 @@ func install(serviceName string, serviceVersion, noFileSoftLimit, noFileHardLimi
 	return nil
 }
 
-func uninstall(serviceName string, serviceVersion uint64, conf config) error {
-	confPath := getConfPath(serviceName, serviceVersion, conf)
+// getRunAs returns the user and group services should run as
+func getRunAs() (string, string) {
+	user := os.Getenv("HAILO_INIT_RUNASUSER")
+	group := os.Getenv("HAILO_INIT_RUNASGROUP")
+
+	if user == "" {
+		user = defaultUser
+		log.Info("HAILO_INIT_RUNASUSER was not set - defaulting to " + user)
+	}
+
+	if group == "" {
+		group = defaultGroup
+		log.Info("HAILO_INIT_RUNASGROUP was not set - defaulting to " + group)
+	}
+
+	return user, group
+}
+
+// Command returns a command which runs as the user and group services run
+// as, with only the environment they inherit, for running commands on their
+// behalf
+func Command(name string, args ...string) (*exec.Cmd, error) {
+	credential, err := getCredential()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Env = environList(inheritedEnvironment())
+	if credential != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	}
+	return cmd, nil
+}
+
+// getNoFileLimits applies the minimum soft and hard nofile limits
+func getNoFileLimits(noFileSoftLimit, noFileHardLimit uint64) (uint64, uint64) {
+	if noFileSoftLimit < 1024 {
+		noFileSoftLimit = 1024
+	}
+
+	if noFileHardLimit < 1024 {
+		noFileHardLimit = 4096
+	}
+
+	return noFileSoftLimit, noFileHardLimit
+}
+
+func uninstall(serviceName string, serviceVersion uint64, instance int, conf config) error {
+	confPath := getConfPath(serviceName, serviceVersion, instance, conf)
 	if err := os.Remove(confPath); err != nil {
 		return err
 	}
@@ -272,6 +439,28 @@ func uninstall(serviceName string, serviceVersion uint64, conf config) error {
 	return nil
 }
 
+// listInstalled lists the services with an init config in a directory
+func listInstalled(conf config, matching string) ([]string, error) {
+	files, err := ioutil.ReadDir(conf.Directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, conf.Extension) || !strings.Contains(name, matching) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(strings.TrimSuffix(name, conf.Extension), conf.TemplateSuffix))
+	}
+
+	return names, nil
+}
+
 func getMachineClass() string {
 	myClass := os.Getenv("H2O_MACHINE_CLASS")
 	if len(myClass) == 0 {
@@ -31,7 +31,7 @@ func TestStartStop(t *testing.T) {
 	createTestFile(filename)
 	defer os.Remove(filename)
 
-	if err := Start("com.HailoOSS.service.provisioning.testprocess", 20130102030405, 1024, 4096); err != nil {
+	if err := Start("com.HailoOSS.service.provisioning.testprocess", 20130102030405, 0, 1024, 4096); err != nil {
 		t.Error("Error testing Start():", err)
 	}
 
@@ -43,7 +43,7 @@ func TestStartStop(t *testing.T) {
 		t.Error("Expecting our made up provisioned service to be running")
 	}
 
-	if err := Stop("com.HailoOSS.service.provisioning.testprocess", 20130102030405); err != nil {
+	if err := Stop("com.HailoOSS.service.provisioning.testprocess", 20130102030405, 0); err != nil {
 		t.Error("Error testing Stop():", err)
 	}
 
@@ -0,0 +1,156 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+type systemd platform
+
+var (
+	defaultSystemdConfDir = "/etc/systemd/system"
+)
+
+func newSystemd() *systemd {
+	return &systemd{
+		InitCmd: "systemctl",
+		Config: config{
+			Directory:      getConfDir(defaultSystemdConfDir),
+			Extension:      ".service",
+			TemplateSuffix: "@",
+		},
+	}
+}
+
+// Install writes the template unit of a service, <service>-<version>@.service,
+// which every instance is started from
+func (env *systemd) Install(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
+	templateText := `
+# Auto-generated by the provisioning service at {{.GeneratedAt}}
+# Author: {{.Author}}
+
+[Unit]
+Description={{.Description}} instance %i
+After=network.target
+StartLimitIntervalSec=5
+StartLimitBurst=10
+
+[Service]
+Type=simple
+User={{.RunAsUser}}
+Group={{.RunAsGroup}}
+LimitNOFILE={{.NoFileSoftLimit}}:{{.NoFileHardLimit}}
+Environment=INSTANCE_INDEX=%i
+{{with cgroupSlice}}Slice={{.}}
+{{end}}{{with .CPUQuota}}CPUQuota={{.}}%
+{{end}}{{with .MemoryMax}}MemoryMax={{.}}
+{{end}}ExecStart=/bin/sh -c {{printf "%s 1>>/opt/hailo/var/log/%s-console.log 2>>/opt/hailo/var/log/%s-error.log" .Launch .LogName .LogName | systemdQuote}}
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`
+
+	tmpl, err := template.New("systemd").Funcs(template.FuncMap{"cgroupSlice": cgroupSlice, "systemdQuote": systemdQuote}).Parse(templateText)
+	if err != nil {
+		return err
+	}
+
+	return install(serviceName, serviceVersion, anyInstance, noFileSoftLimit, noFileHardLimit, env.Config, tmpl)
+}
+
+func (env *systemd) List(matching string) ([]string, error) {
+	cmd := exec.Command(env.InitCmd, "list-units", "--type=service", "--state=running", "--no-legend", "--no-pager", "--plain")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err != nil {
+		return []string{}, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out.Bytes()))
+	processes := make([]string, 0)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 || !strings.HasSuffix(parts[0], env.Config.Extension) {
+			continue
+		}
+
+		name := strings.TrimSuffix(parts[0], env.Config.Extension)
+		if len(matching) == 0 || strings.Contains(name, matching) {
+			processes = append(processes, name)
+		}
+	}
+
+	return processes, nil
+}
+
+func (env *systemd) Start(serviceName string, serviceVersion uint64, instance int, noFileSoftLimit, noFileHardLimit uint64) error {
+	if err := env.Install(serviceName, serviceVersion, instance, noFileSoftLimit, noFileHardLimit); err != nil {
+		return err
+	}
+
+	if err := run(env.InitCmd, "daemon-reload"); err != nil {
+		return fmt.Errorf("Tried to reload unit files: %v", err)
+	}
+
+	unitName := InstanceName(serviceName, serviceVersion, instance) + env.Config.Extension
+	if err := run(env.InitCmd, "enable", unitName); err != nil {
+		return fmt.Errorf("Tried to enable %s: %v", unitName, err)
+	}
+
+	if err := run(env.InitCmd, "start", unitName); err != nil {
+		return fmt.Errorf("Tried to start %s: %v", unitName, err)
+	}
+
+	return nil
+}
+
+func (env *systemd) Stop(serviceName string, serviceVersion uint64, instance int) error {
+	unitName := InstanceName(serviceName, serviceVersion, instance) + env.Config.Extension
+	if err := run(env.InitCmd, "stop", unitName); err != nil {
+		return fmt.Errorf("Tried to stop %s: %v", unitName, err)
+	}
+
+	return env.Uninstall(serviceName, serviceVersion, instance)
+}
+
+func (env *systemd) Restart(serviceName string, serviceVersion uint64, instance int) error {
+	unitName := InstanceName(serviceName, serviceVersion, instance) + env.Config.Extension
+	if err := run(env.InitCmd, "restart", unitName); err != nil {
+		return fmt.Errorf("Tried to restart %s: %v", unitName, err)
+	}
+
+	return nil
+}
+
+// Uninstall disables the unit of an instance, so no wants symlink is left
+// pointing at it. The template unit is removed once no instances are running.
+func (env *systemd) Uninstall(serviceName string, serviceVersion uint64, instance int) error {
+	unitName := InstanceName(serviceName, serviceVersion, instance) + env.Config.Extension
+	if err := run(env.InitCmd, "disable", unitName); err != nil {
+		return fmt.Errorf("Tried to disable %s: %v", unitName, err)
+	}
+
+	if running, err := RunningInstances(serviceName, serviceVersion); err != nil || len(running) > 0 {
+		return err
+	}
+
+	if err := uninstall(serviceName, serviceVersion, anyInstance, env.Config); err != nil {
+		return err
+	}
+
+	if err := run(env.InitCmd, "daemon-reload"); err != nil {
+		return fmt.Errorf("Tried to reload unit files: %v", err)
+	}
+
+	return nil
+}
+
+func (env *systemd) Installed(matching string) ([]string, error) {
+	return listInstalled(env.Config, matching)
+}
@@ -0,0 +1,65 @@
+// Code generated by protoc-gen-go.
+// source: github.com/HailoOSS/provisioning-service/proto/changed/changed.proto
+// DO NOT EDIT!
+
+/*
+Package com_HailoOSS_service_provisioning_changed is a generated protocol buffer package.
+
+It is generated from these files:
+	github.com/HailoOSS/provisioning-service/proto/changed/changed.proto
+
+It has these top-level messages:
+	Request
+	Response
+*/
+package com_HailoOSS_service_provisioning_changed
+
+import proto "github.com/HailoOSS/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type Request struct {
+	MachineClass     *string `protobuf:"bytes,1,opt,name=machineClass" json:"machineClass,omitempty"`
+	ServiceName      *string `protobuf:"bytes,2,opt,name=serviceName" json:"serviceName,omitempty"`
+	ServiceVersion   *uint64 `protobuf:"varint,3,opt,name=serviceVersion" json:"serviceVersion,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Request) Reset()         { *m = Request{} }
+func (m *Request) String() string { return proto.CompactTextString(m) }
+func (*Request) ProtoMessage()    {}
+
+func (m *Request) GetMachineClass() string {
+	if m != nil && m.MachineClass != nil {
+		return *m.MachineClass
+	}
+	return ""
+}
+
+func (m *Request) GetServiceName() string {
+	if m != nil && m.ServiceName != nil {
+		return *m.ServiceName
+	}
+	return ""
+}
+
+func (m *Request) GetServiceVersion() uint64 {
+	if m != nil && m.ServiceVersion != nil {
+		return *m.ServiceVersion
+	}
+	return 0
+}
+
+type Response struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Response) Reset()         { *m = Response{} }
+func (m *Response) String() string { return proto.CompactTextString(m) }
+func (*Response) ProtoMessage()    {}
+
+func init() {
+}
@@ -12,6 +12,9 @@ It has these top-level messages:
 	Resource
 	Service
 	Machine
+	Maintenance
+	Override
+	Cache
 	Info
 */
 package com_HailoOSS_kernel_provisioning
@@ -60,6 +63,7 @@ type Service struct {
 	Version          *string   `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
 	Usage            *Resource `protobuf:"bytes,3,opt,name=usage" json:"usage,omitempty"`
 	Allocation       *Resource `protobuf:"bytes,4,opt,name=allocation" json:"allocation,omitempty"`
+	OomKills         *uint64   `protobuf:"varint,5,opt,name=oomKills" json:"oomKills,omitempty"`
 	XXX_unrecognized []byte    `json:"-"`
 }
 
@@ -95,6 +99,13 @@ func (m *Service) GetAllocation() *Resource {
 	return nil
 }
 
+func (m *Service) GetOomKills() uint64 {
+	if m != nil && m.OomKills != nil {
+		return *m.OomKills
+	}
+	return 0
+}
+
 type Machine struct {
 	Cores            *uint64   `protobuf:"varint,1,req,name=cores" json:"cores,omitempty"`
 	Memory           *uint64   `protobuf:"varint,2,req,name=memory" json:"memory,omitempty"`
@@ -135,19 +146,150 @@ func (m *Machine) GetUsage() *Resource {
 	return nil
 }
 
+type Maintenance struct {
+	Services         []string `protobuf:"bytes,1,rep,name=services" json:"services,omitempty"`
+	Started          *uint64  `protobuf:"varint,2,opt,name=started" json:"started,omitempty"`
+	Until            *uint64  `protobuf:"varint,3,opt,name=until" json:"until,omitempty"`
+	Reason           *string  `protobuf:"bytes,4,opt,name=reason" json:"reason,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Maintenance) Reset()         { *m = Maintenance{} }
+func (m *Maintenance) String() string { return proto.CompactTextString(m) }
+func (*Maintenance) ProtoMessage()    {}
+
+func (m *Maintenance) GetServices() []string {
+	if m != nil {
+		return m.Services
+	}
+	return nil
+}
+
+func (m *Maintenance) GetStarted() uint64 {
+	if m != nil && m.Started != nil {
+		return *m.Started
+	}
+	return 0
+}
+
+func (m *Maintenance) GetUntil() uint64 {
+	if m != nil && m.Until != nil {
+		return *m.Until
+	}
+	return 0
+}
+
+func (m *Maintenance) GetReason() string {
+	if m != nil && m.Reason != nil {
+		return *m.Reason
+	}
+	return ""
+}
+
+type Override struct {
+	Type             *string `protobuf:"bytes,1,req,name=type" json:"type,omitempty"`
+	ServiceName      *string `protobuf:"bytes,2,req,name=serviceName" json:"serviceName,omitempty"`
+	ServiceVersion   *uint64 `protobuf:"varint,3,opt,name=serviceVersion" json:"serviceVersion,omitempty"`
+	Expires          *uint64 `protobuf:"varint,4,opt,name=expires" json:"expires,omitempty"`
+	Reason           *string `protobuf:"bytes,5,opt,name=reason" json:"reason,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Override) Reset()         { *m = Override{} }
+func (m *Override) String() string { return proto.CompactTextString(m) }
+func (*Override) ProtoMessage()    {}
+
+func (m *Override) GetType() string {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return ""
+}
+
+func (m *Override) GetServiceName() string {
+	if m != nil && m.ServiceName != nil {
+		return *m.ServiceName
+	}
+	return ""
+}
+
+func (m *Override) GetServiceVersion() uint64 {
+	if m != nil && m.ServiceVersion != nil {
+		return *m.ServiceVersion
+	}
+	return 0
+}
+
+func (m *Override) GetExpires() uint64 {
+	if m != nil && m.Expires != nil {
+		return *m.Expires
+	}
+	return 0
+}
+
+func (m *Override) GetReason() string {
+	if m != nil && m.Reason != nil {
+		return *m.Reason
+	}
+	return ""
+}
+
+type Cache struct {
+	Fetched          *uint64 `protobuf:"varint,1,req,name=fetched" json:"fetched,omitempty"`
+	Age              *uint64 `protobuf:"varint,2,req,name=age" json:"age,omitempty"`
+	Source           *string `protobuf:"bytes,3,req,name=source" json:"source,omitempty"`
+	FromCache        *bool   `protobuf:"varint,4,opt,name=fromCache" json:"fromCache,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Cache) Reset()         { *m = Cache{} }
+func (m *Cache) String() string { return proto.CompactTextString(m) }
+func (*Cache) ProtoMessage()    {}
+
+func (m *Cache) GetFetched() uint64 {
+	if m != nil && m.Fetched != nil {
+		return *m.Fetched
+	}
+	return 0
+}
+
+func (m *Cache) GetAge() uint64 {
+	if m != nil && m.Age != nil {
+		return *m.Age
+	}
+	return 0
+}
+
+func (m *Cache) GetSource() string {
+	if m != nil && m.Source != nil {
+		return *m.Source
+	}
+	return ""
+}
+
+func (m *Cache) GetFromCache() bool {
+	if m != nil && m.FromCache != nil {
+		return *m.FromCache
+	}
+	return false
+}
+
 type Info struct {
-	Id               *string    `protobuf:"bytes,1,req,name=id" json:"id,omitempty"`
-	Version          *string    `protobuf:"bytes,2,req,name=version" json:"version,omitempty"`
-	Hostname         *string    `protobuf:"bytes,3,req,name=hostname" json:"hostname,omitempty"`
-	IpAddress        *string    `protobuf:"bytes,4,req,name=ipAddress" json:"ipAddress,omitempty"`
-	AzName           *string    `protobuf:"bytes,5,req,name=azName" json:"azName,omitempty"`
-	MachineClass     *string    `protobuf:"bytes,6,req,name=machineClass" json:"machineClass,omitempty"`
-	Started          *uint64    `protobuf:"varint,7,req,name=started" json:"started,omitempty"`
-	Timestamp        *uint64    `protobuf:"varint,8,req,name=timestamp" json:"timestamp,omitempty"`
-	Machine          *Machine   `protobuf:"bytes,9,req,name=machine" json:"machine,omitempty"`
-	Processes        []*Service `protobuf:"bytes,10,rep,name=processes" json:"processes,omitempty"`
-	Containers       []*Service `protobuf:"bytes,11,rep,name=containers" json:"containers,omitempty"`
-	XXX_unrecognized []byte     `json:"-"`
+	Id               *string      `protobuf:"bytes,1,req,name=id" json:"id,omitempty"`
+	Version          *string      `protobuf:"bytes,2,req,name=version" json:"version,omitempty"`
+	Hostname         *string      `protobuf:"bytes,3,req,name=hostname" json:"hostname,omitempty"`
+	IpAddress        *string      `protobuf:"bytes,4,req,name=ipAddress" json:"ipAddress,omitempty"`
+	AzName           *string      `protobuf:"bytes,5,req,name=azName" json:"azName,omitempty"`
+	MachineClass     *string      `protobuf:"bytes,6,req,name=machineClass" json:"machineClass,omitempty"`
+	Started          *uint64      `protobuf:"varint,7,req,name=started" json:"started,omitempty"`
+	Timestamp        *uint64      `protobuf:"varint,8,req,name=timestamp" json:"timestamp,omitempty"`
+	Machine          *Machine     `protobuf:"bytes,9,req,name=machine" json:"machine,omitempty"`
+	Processes        []*Service   `protobuf:"bytes,10,rep,name=processes" json:"processes,omitempty"`
+	Containers       []*Service   `protobuf:"bytes,11,rep,name=containers" json:"containers,omitempty"`
+	Maintenance      *Maintenance `protobuf:"bytes,12,opt,name=maintenance" json:"maintenance,omitempty"`
+	Overrides        []*Override  `protobuf:"bytes,13,rep,name=overrides" json:"overrides,omitempty"`
+	Cache            *Cache       `protobuf:"bytes,14,opt,name=cache" json:"cache,omitempty"`
+	XXX_unrecognized []byte       `json:"-"`
 }
 
 func (m *Info) Reset()         { *m = Info{} }
@@ -231,5 +373,26 @@ func (m *Info) GetContainers() []*Service {
 	return nil
 }
 
+func (m *Info) GetMaintenance() *Maintenance {
+	if m != nil {
+		return m.Maintenance
+	}
+	return nil
+}
+
+func (m *Info) GetOverrides() []*Override {
+	if m != nil {
+		return m.Overrides
+	}
+	return nil
+}
+
+func (m *Info) GetCache() *Cache {
+	if m != nil {
+		return m.Cache
+	}
+	return nil
+}
+
 func init() {
 }
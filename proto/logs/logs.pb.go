@@ -0,0 +1,137 @@
+// Code generated by protoc-gen-go.
+// source: github.com/HailoOSS/provisioning-service/proto/logs/logs.proto
+// DO NOT EDIT!
+
+/*
+Package com_HailoOSS_service_provisioning_logs is a generated protocol buffer package.
+
+It is generated from these files:
+	github.com/HailoOSS/provisioning-service/proto/logs/logs.proto
+
+It has these top-level messages:
+	Request
+	Response
+*/
+package com_HailoOSS_service_provisioning_logs
+
+import proto "github.com/HailoOSS/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type Request struct {
+	ServiceName      *string `protobuf:"bytes,1,req,name=serviceName" json:"serviceName,omitempty"`
+	ServiceVersion   *uint64 `protobuf:"varint,2,req,name=serviceVersion" json:"serviceVersion,omitempty"`
+	ServiceType      *string `protobuf:"bytes,3,opt,name=serviceType" json:"serviceType,omitempty"`
+	Instance         *int32  `protobuf:"varint,4,opt,name=instance" json:"instance,omitempty"`
+	Stream           *string `protobuf:"bytes,5,opt,name=stream" json:"stream,omitempty"`
+	Lines            *int64  `protobuf:"varint,6,opt,name=lines" json:"lines,omitempty"`
+	Bytes            *int64  `protobuf:"varint,7,opt,name=bytes" json:"bytes,omitempty"`
+	Offset           *int64  `protobuf:"varint,8,opt,name=offset" json:"offset,omitempty"`
+	Grep             *string `protobuf:"bytes,9,opt,name=grep" json:"grep,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Request) Reset()         { *m = Request{} }
+func (m *Request) String() string { return proto.CompactTextString(m) }
+func (*Request) ProtoMessage()    {}
+
+func (m *Request) GetServiceName() string {
+	if m != nil && m.ServiceName != nil {
+		return *m.ServiceName
+	}
+	return ""
+}
+
+func (m *Request) GetServiceVersion() uint64 {
+	if m != nil && m.ServiceVersion != nil {
+		return *m.ServiceVersion
+	}
+	return 0
+}
+
+func (m *Request) GetServiceType() string {
+	if m != nil && m.ServiceType != nil {
+		return *m.ServiceType
+	}
+	return ""
+}
+
+func (m *Request) GetInstance() int32 {
+	if m != nil && m.Instance != nil {
+		return *m.Instance
+	}
+	return 0
+}
+
+func (m *Request) GetStream() string {
+	if m != nil && m.Stream != nil {
+		return *m.Stream
+	}
+	return ""
+}
+
+func (m *Request) GetLines() int64 {
+	if m != nil && m.Lines != nil {
+		return *m.Lines
+	}
+	return 0
+}
+
+func (m *Request) GetBytes() int64 {
+	if m != nil && m.Bytes != nil {
+		return *m.Bytes
+	}
+	return 0
+}
+
+func (m *Request) GetOffset() int64 {
+	if m != nil && m.Offset != nil {
+		return *m.Offset
+	}
+	return 0
+}
+
+func (m *Request) GetGrep() string {
+	if m != nil && m.Grep != nil {
+		return *m.Grep
+	}
+	return ""
+}
+
+type Response struct {
+	Lines            []string `protobuf:"bytes,1,rep,name=lines" json:"lines,omitempty"`
+	Offset           *int64   `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Size             *int64   `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Response) Reset()         { *m = Response{} }
+func (m *Response) String() string { return proto.CompactTextString(m) }
+func (*Response) ProtoMessage()    {}
+
+func (m *Response) GetLines() []string {
+	if m != nil {
+		return m.Lines
+	}
+	return nil
+}
+
+func (m *Response) GetOffset() int64 {
+	if m != nil && m.Offset != nil {
+		return *m.Offset
+	}
+	return 0
+}
+
+func (m *Response) GetSize() int64 {
+	if m != nil && m.Size != nil {
+		return *m.Size
+	}
+	return 0
+}
+
+func init() {
+}
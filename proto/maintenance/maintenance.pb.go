@@ -0,0 +1,121 @@
+// Code generated by protoc-gen-go.
+// source: github.com/HailoOSS/provisioning-service/proto/maintenance/maintenance.proto
+// DO NOT EDIT!
+
+/*
+Package com_HailoOSS_service_provisioning_maintenance is a generated protocol buffer package.
+
+It is generated from these files:
+	github.com/HailoOSS/provisioning-service/proto/maintenance/maintenance.proto
+
+It has these top-level messages:
+	Request
+	Response
+*/
+package com_HailoOSS_service_provisioning_maintenance
+
+import proto "github.com/HailoOSS/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type Request struct {
+	Enabled          *bool    `protobuf:"varint,1,opt,name=enabled" json:"enabled,omitempty"`
+	Services         []string `protobuf:"bytes,2,rep,name=services" json:"services,omitempty"`
+	Duration         *int64   `protobuf:"varint,3,opt,name=duration" json:"duration,omitempty"`
+	Reason           *string  `protobuf:"bytes,4,opt,name=reason" json:"reason,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Request) Reset()         { *m = Request{} }
+func (m *Request) String() string { return proto.CompactTextString(m) }
+func (*Request) ProtoMessage()    {}
+
+func (m *Request) GetEnabled() bool {
+	if m != nil && m.Enabled != nil {
+		return *m.Enabled
+	}
+	return false
+}
+
+func (m *Request) GetServices() []string {
+	if m != nil {
+		return m.Services
+	}
+	return nil
+}
+
+func (m *Request) GetDuration() int64 {
+	if m != nil && m.Duration != nil {
+		return *m.Duration
+	}
+	return 0
+}
+
+func (m *Request) GetReason() string {
+	if m != nil && m.Reason != nil {
+		return *m.Reason
+	}
+	return ""
+}
+
+type Response struct {
+	Enabled          *bool    `protobuf:"varint,1,opt,name=enabled" json:"enabled,omitempty"`
+	Services         []string `protobuf:"bytes,2,rep,name=services" json:"services,omitempty"`
+	Started          *int64   `protobuf:"varint,3,opt,name=started" json:"started,omitempty"`
+	Until            *int64   `protobuf:"varint,4,opt,name=until" json:"until,omitempty"`
+	Reason           *string  `protobuf:"bytes,5,opt,name=reason" json:"reason,omitempty"`
+	User             *string  `protobuf:"bytes,6,opt,name=user" json:"user,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Response) Reset()         { *m = Response{} }
+func (m *Response) String() string { return proto.CompactTextString(m) }
+func (*Response) ProtoMessage()    {}
+
+func (m *Response) GetEnabled() bool {
+	if m != nil && m.Enabled != nil {
+		return *m.Enabled
+	}
+	return false
+}
+
+func (m *Response) GetServices() []string {
+	if m != nil {
+		return m.Services
+	}
+	return nil
+}
+
+func (m *Response) GetStarted() int64 {
+	if m != nil && m.Started != nil {
+		return *m.Started
+	}
+	return 0
+}
+
+func (m *Response) GetUntil() int64 {
+	if m != nil && m.Until != nil {
+		return *m.Until
+	}
+	return 0
+}
+
+func (m *Response) GetReason() string {
+	if m != nil && m.Reason != nil {
+		return *m.Reason
+	}
+	return ""
+}
+
+func (m *Response) GetUser() string {
+	if m != nil && m.User != nil {
+		return *m.User
+	}
+	return ""
+}
+
+func init() {
+}
@@ -0,0 +1,130 @@
+// Code generated by protoc-gen-go.
+// source: github.com/HailoOSS/provisioning-service/proto/plan/plan.proto
+// DO NOT EDIT!
+
+/*
+Package com_HailoOSS_service_provisioning_plan is a generated protocol buffer package.
+
+It is generated from these files:
+	github.com/HailoOSS/provisioning-service/proto/plan/plan.proto
+
+It has these top-level messages:
+	Request
+	Action
+	Response
+*/
+package com_HailoOSS_service_provisioning_plan
+
+import proto "github.com/HailoOSS/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type Request struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Request) Reset()         { *m = Request{} }
+func (m *Request) String() string { return proto.CompactTextString(m) }
+func (*Request) ProtoMessage()    {}
+
+type Action struct {
+	ServiceName      *string  `protobuf:"bytes,1,req,name=serviceName" json:"serviceName,omitempty"`
+	ServiceVersion   *uint64  `protobuf:"varint,2,req,name=serviceVersion" json:"serviceVersion,omitempty"`
+	ServiceType      *string  `protobuf:"bytes,3,req,name=serviceType" json:"serviceType,omitempty"`
+	Action           *string  `protobuf:"bytes,4,req,name=action" json:"action,omitempty"`
+	Steps            []string `protobuf:"bytes,5,rep,name=steps" json:"steps,omitempty"`
+	Skipped          *string  `protobuf:"bytes,6,opt,name=skipped" json:"skipped,omitempty"`
+	Instance         *int32   `protobuf:"varint,7,opt,name=instance" json:"instance,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Action) Reset()         { *m = Action{} }
+func (m *Action) String() string { return proto.CompactTextString(m) }
+func (*Action) ProtoMessage()    {}
+
+func (m *Action) GetServiceName() string {
+	if m != nil && m.ServiceName != nil {
+		return *m.ServiceName
+	}
+	return ""
+}
+
+func (m *Action) GetServiceVersion() uint64 {
+	if m != nil && m.ServiceVersion != nil {
+		return *m.ServiceVersion
+	}
+	return 0
+}
+
+func (m *Action) GetServiceType() string {
+	if m != nil && m.ServiceType != nil {
+		return *m.ServiceType
+	}
+	return ""
+}
+
+func (m *Action) GetAction() string {
+	if m != nil && m.Action != nil {
+		return *m.Action
+	}
+	return ""
+}
+
+func (m *Action) GetSteps() []string {
+	if m != nil {
+		return m.Steps
+	}
+	return nil
+}
+
+func (m *Action) GetSkipped() string {
+	if m != nil && m.Skipped != nil {
+		return *m.Skipped
+	}
+	return ""
+}
+
+func (m *Action) GetInstance() int32 {
+	if m != nil && m.Instance != nil {
+		return *m.Instance
+	}
+	return 0
+}
+
+type Response struct {
+	Created          *int64    `protobuf:"varint,1,opt,name=created" json:"created,omitempty"`
+	Actions          []*Action `protobuf:"bytes,2,rep,name=actions" json:"actions,omitempty"`
+	Errors           []string  `protobuf:"bytes,3,rep,name=errors" json:"errors,omitempty"`
+	XXX_unrecognized []byte    `json:"-"`
+}
+
+func (m *Response) Reset()         { *m = Response{} }
+func (m *Response) String() string { return proto.CompactTextString(m) }
+func (*Response) ProtoMessage()    {}
+
+func (m *Response) GetCreated() int64 {
+	if m != nil && m.Created != nil {
+		return *m.Created
+	}
+	return 0
+}
+
+func (m *Response) GetActions() []*Action {
+	if m != nil {
+		return m.Actions
+	}
+	return nil
+}
+
+func (m *Response) GetErrors() []string {
+	if m != nil {
+		return m.Errors
+	}
+	return nil
+}
+
+func init() {
+}
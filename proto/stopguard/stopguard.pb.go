@@ -0,0 +1,65 @@
+// Code generated by protoc-gen-go.
+// source: github.com/HailoOSS/provisioning-service/proto/stopguard/stopguard.proto
+// DO NOT EDIT!
+
+/*
+Package com_HailoOSS_service_provisioning_stopguard is a generated protocol buffer package.
+
+It is generated from these files:
+	github.com/HailoOSS/provisioning-service/proto/stopguard/stopguard.proto
+
+It has these top-level messages:
+	Request
+	Response
+*/
+package com_HailoOSS_service_provisioning_stopguard
+
+import proto "github.com/HailoOSS/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type Request struct {
+	Confirm          *bool  `protobuf:"varint,1,opt,name=confirm" json:"confirm,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Request) Reset()         { *m = Request{} }
+func (m *Request) String() string { return proto.CompactTextString(m) }
+func (*Request) ProtoMessage()    {}
+
+func (m *Request) GetConfirm() bool {
+	if m != nil && m.Confirm != nil {
+		return *m.Confirm
+	}
+	return false
+}
+
+type Response struct {
+	Held             []string `protobuf:"bytes,1,rep,name=held" json:"held,omitempty"`
+	Confirmed        []string `protobuf:"bytes,2,rep,name=confirmed" json:"confirmed,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Response) Reset()         { *m = Response{} }
+func (m *Response) String() string { return proto.CompactTextString(m) }
+func (*Response) ProtoMessage()    {}
+
+func (m *Response) GetHeld() []string {
+	if m != nil {
+		return m.Held
+	}
+	return nil
+}
+
+func (m *Response) GetConfirmed() []string {
+	if m != nil {
+		return m.Confirmed
+	}
+	return nil
+}
+
+func init() {
+}
@@ -0,0 +1,316 @@
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/pkgmgr"
+	"github.com/HailoOSS/provisioning-service/process"
+)
+
+const (
+	defaultKeepVersions  = 2
+	defaultDiskThreshold = 0.85
+	cleanInterval        = time.Hour
+	// how often to clean while disk usage stays above the threshold
+	pressureInterval = time.Minute
+)
+
+var (
+	// files kept next to a binary, which go when the binary goes
+	sidecarExtensions = []string{".part", ".md5", ".sha256", ".tmp", ".manifest", ".manifest.sig"}
+	binaries          = newBinaryJanitor()
+)
+
+// binaryJanitor removes binaries and init configs of services which are no
+// longer provisioned, keeping the most recent versions of each service so
+// they can be rolled back to. It runs after a check's tasks, but tasks which
+// timed out may still be running, so services the workers are busy with are
+// left alone.
+type binaryJanitor struct {
+	exeDir        string
+	keepVersions  int
+	diskThreshold float64
+	lastClean     time.Time
+}
+
+func newBinaryJanitor() *binaryJanitor {
+	keep, err := strconv.Atoi(os.Getenv("H2O_JANITOR_KEEP_VERSIONS"))
+	if err != nil || keep < 0 {
+		keep = defaultKeepVersions
+	}
+
+	threshold, err := strconv.ParseFloat(os.Getenv("H2O_JANITOR_DISK_THRESHOLD"), 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		threshold = defaultDiskThreshold
+	}
+
+	return &binaryJanitor{
+		exeDir:        process.ExeDir(),
+		keepVersions:  keep,
+		diskThreshold: threshold,
+	}
+}
+
+// clean removes unused files once an hour, or more often when the disk is
+// filling up
+func (j *binaryJanitor) clean(services dao.ProvisionedServices) {
+	pressure := false
+	if usage, err := diskUsage(j.exeDir); err != nil {
+		log.Debugf("Unable to check disk usage of %s: %v", j.exeDir, err)
+	} else if usage >= j.diskThreshold {
+		pressure = true
+	}
+
+	since := time.Since(j.lastClean)
+	if since < pressureInterval || (!pressure && since < cleanInterval) {
+		return
+	}
+	j.lastClean = time.Now()
+
+	if pressure {
+		log.Warnf("Disk usage of %s is above %.0f%%, cleaning up", j.exeDir, j.diskThreshold*100)
+	} else {
+		log.Debugf("Checking for unused binaries")
+	}
+
+	referenced, err := j.referenced(services)
+	if err != nil {
+		log.Errorf("Unable to list running services, not cleaning up: %v", err)
+		return
+	}
+
+	j.removeInitConfigs(referenced)
+	j.removeBinaries(referenced)
+
+	// package manager working files are shared by every download
+	if pressure && workers.anyBusy() {
+		log.Warnf("Not cleaning package manager working files while tasks are still running")
+	} else if pressure {
+		if err := pkgmgr.Clean(); err != nil {
+			log.Errorf("Unable to clean package manager working files: %v", err)
+		}
+	}
+}
+
+// referenced returns the builds which are provisioned, running or known-good,
+// along with the instances of them which should keep their init configs
+func (j *binaryJanitor) referenced(services dao.ProvisionedServices) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, service := range services {
+		referenced[combineNameVersion(service.ServiceName, service.ServiceVersion)] = true
+		for i := 0; i < service.DesiredInstances(); i++ {
+			referenced[process.InstanceName(service.ServiceName, service.ServiceVersion, i)] = true
+		}
+	}
+
+	running, err := process.ListRunning("com.HailoOSS")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range running {
+		referenced[filepath.Base(name)] = true
+		if name, version, _, err := splitInstanceName(name); err == nil {
+			referenced[combineNameVersion(name, version)] = true
+		}
+	}
+
+	for _, build := range knownGood.builds() {
+		referenced[build] = true
+	}
+
+	return referenced, nil
+}
+
+// busy returns whether the workers are busy with a build or an instance of
+// it, which may be downloading or starting
+func (j *binaryJanitor) busy(build string) bool {
+	if name, version, _, err := splitInstanceName(build); err == nil {
+		return workers.isBusy(combineNameVersion(name, version))
+	}
+	return workers.isBusy(build)
+}
+
+func (j *binaryJanitor) removeInitConfigs(referenced map[string]bool) {
+	installed, err := process.ListInstalled("com.HailoOSS")
+	if err != nil {
+		log.Errorf("Unable to list installed init configs: %v", err)
+		return
+	}
+
+	for _, build := range installed {
+		if referenced[build] || j.busy(build) {
+			continue
+		}
+
+		name, version, instance, err := splitInstanceName(build)
+		if err != nil {
+			continue
+		}
+
+		if err := process.Uninstall(name, version, instance); err != nil {
+			log.Errorf("Unable to remove init config of %s: %v", build, err)
+			continue
+		}
+		log.Infof("Removed orphaned init config of %s", build)
+	}
+}
+
+// unused returns the files in the binary directory which can go
+func (j *binaryJanitor) unused(referenced map[string]bool) ([]string, error) {
+	files, err := ioutil.ReadDir(j.exeDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() {
+			names = append(names, f.Name())
+		}
+	}
+
+	return unusedFiles(names, referenced, j.keepVersions), nil
+}
+
+func (j *binaryJanitor) removeBinaries(referenced map[string]bool) {
+	unused, err := j.unused(referenced)
+	if err != nil {
+		log.Errorf("Unable to list binaries: %v", err)
+		return
+	}
+
+	for _, name := range unused {
+		if build, _ := splitSidecar(name); j.busy(build) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(j.exeDir, name)); err != nil {
+			log.Errorf("Unable to remove %s: %v", name, err)
+			continue
+		}
+		log.Infof("Removed unused file %s", name)
+	}
+}
+
+// binaryDeletes plans the binaries the janitor would remove when it next
+// runs. The tasks are only for plans, and can't be run.
+func (p *planner) binaryDeletes(services dao.ProvisionedServices) {
+	referenced, err := binaries.referenced(services)
+	if err != nil {
+		p.error(err)
+		return
+	}
+
+	unused, err := binaries.unused(referenced)
+	if err != nil {
+		p.error(err)
+		return
+	}
+
+	for _, file := range unused {
+		if _, sidecar := splitSidecar(file); sidecar {
+			continue
+		}
+
+		name, version, err := splitProcessName(file)
+		if err != nil {
+			continue
+		}
+
+		p.add(task{
+			action:  actionClean,
+			name:    name,
+			version: version,
+			typ:     dao.ServiceTypeProcess,
+			steps:   []string{stepDeleteBinary},
+		})
+	}
+}
+
+// splitSidecar returns the build a file belongs to, and whether it is a
+// sidecar rather than the binary itself
+func splitSidecar(file string) (string, bool) {
+	for _, ext := range sidecarExtensions {
+		if strings.HasSuffix(file, ext) {
+			return strings.TrimSuffix(file, ext), true
+		}
+	}
+	return file, false
+}
+
+// unusedFiles works out which files in the binary directory can go. Binaries
+// are kept if they are referenced or among the newest keep versions of their
+// service. Sidecars go with their binary, or when they have no binary.
+func unusedFiles(files []string, referenced map[string]bool, keep int) []string {
+	versions := make(map[string][]uint64)
+	for _, file := range files {
+		if _, sidecar := splitSidecar(file); sidecar {
+			continue
+		}
+
+		name, version, err := splitProcessName(file)
+		if err != nil {
+			continue
+		}
+		versions[name] = append(versions[name], version)
+	}
+
+	kept := make(map[string]bool)
+	for build := range referenced {
+		kept[build] = true
+	}
+	for name, vs := range versions {
+		sort.Sort(sort.Reverse(uint64s(vs)))
+		for i := 0; i < keep && i < len(vs); i++ {
+			kept[combineNameVersion(name, vs[i])] = true
+		}
+	}
+
+	var unused []string
+	for _, file := range files {
+		build, _ := splitSidecar(file)
+		if _, _, err := splitProcessName(build); err != nil {
+			// not one of ours
+			continue
+		}
+
+		if kept[build] {
+			continue
+		}
+		unused = append(unused, file)
+	}
+
+	return unused
+}
+
+type uint64s []uint64
+
+func (u uint64s) Len() int           { return len(u) }
+func (u uint64s) Less(i, j int) bool { return u[i] < u[j] }
+func (u uint64s) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+
+// diskUsage returns the fraction of the filesystem holding dir which is used
+func diskUsage(dir string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+
+	if st.Blocks == 0 {
+		return 0, nil
+	}
+
+	return 1 - float64(st.Bavail)/float64(st.Blocks), nil
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestUnusedFiles(t *testing.T) {
+	files := []string{
+		"com.HailoOSS.service.foo-1",
+		"com.HailoOSS.service.foo-1.md5",
+		"com.HailoOSS.service.foo-2",
+		"com.HailoOSS.service.foo-3",
+		"com.HailoOSS.service.foo-4",
+		"com.HailoOSS.service.foo-4.md5",
+		"com.HailoOSS.service.foo-5.part",
+		"com.HailoOSS.service.bar-1",
+		"com.HailoOSS.service.bar-2.part",
+		"com.HailoOSS.service.baz-1.md5",
+		"README",
+	}
+	referenced := map[string]bool{
+		"com.HailoOSS.service.foo-1": true,
+		"com.HailoOSS.service.foo-5": true,
+	}
+
+	unused := unusedFiles(files, referenced, 2)
+	sort.Strings(unused)
+
+	expected := []string{
+		"com.HailoOSS.service.bar-2.part",
+		"com.HailoOSS.service.baz-1.md5",
+		"com.HailoOSS.service.foo-2",
+	}
+	if len(unused) != len(expected) {
+		t.Fatalf("Expected %v to be removed, got %v", expected, unused)
+	}
+	for i := range expected {
+		if unused[i] != expected[i] {
+			t.Errorf("Expected %v to be removed, got %v", expected, unused)
+		}
+	}
+}
+
+func TestRemoveBinariesSkipsBusy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "janitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"com.HailoOSS.service.foo-1", "com.HailoOSS.service.bar-1.part"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(p *pool) { workers = p }(workers)
+	workers = newPool(1, time.Minute)
+	// a timed out download of bar is still running
+	workers.lock("com.HailoOSS.service.bar-1")
+
+	j := &binaryJanitor{exeDir: dir}
+	j.removeBinaries(map[string]bool{})
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != "com.HailoOSS.service.bar-1.part" {
+		t.Errorf("Expected only the busy download to be left, got %v", files)
+	}
+}
@@ -3,82 +3,151 @@ package runner
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	log "github.com/cihub/seelog"
 
-	"github.com/HailoOSS/go-hailo-lib/multierror"
 	"github.com/HailoOSS/provisioning-service/container"
 	"github.com/HailoOSS/provisioning-service/dao"
 	"github.com/HailoOSS/provisioning-service/event"
+	"github.com/HailoOSS/provisioning-service/health"
 )
 
-func startMissingContainers(provisionedServices dao.ProvisionedServices) error {
-	me := multierror.New()
+func startMissingContainers(provisionedServices dao.ProvisionedServices, r *Report) error {
+	p := newPlanner(true, nil)
+	p.ordered(provisionedServices.OfType(dao.ServiceTypeContainer))
+	p.containerStarts(provisionedServices)
+	p.run(r)
+	return nil
+}
 
+// containerStarts plans starting provisioned containers which aren't running
+func (p *planner) containerStarts(provisionedServices dao.ProvisionedServices) {
 	for _, service := range provisionedServices {
 		if service.ServiceType != dao.ServiceTypeContainer {
 			continue
 		}
 
 		name := combineNameVersion(service.ServiceName, service.ServiceVersion)
-		version := strconv.Itoa(int(service.ServiceVersion))
 
 		if container.IsRunning(name) {
+			if p.live && crashes.running(service.ServiceName, service.ServiceVersion) {
+				knownGood.record(service.ServiceName, service.ServiceVersion, service.ServiceType)
+			}
 			continue
 		}
 
-		// Load the service dependencies
-		// We need to expose extra functionality for that
-		// if err := deps.Load(service.ServiceName); err != nil {
-		// 	log.Criticalf("Failed to load dependencies for service %s: %v", service.ServiceName, err)
-		// }
-		log.Debugf("Container %s:%s is not yet running", service.ServiceName, version)
-		if !container.IsDownloaded(service.ServiceName, version) {
-			log.Debugf("Container %s:%s is not yet downloaded", service.ServiceName, version)
-			err := container.Download(service.ServiceName, version)
-			if err != nil {
-				// log error and continue, so we don't block other provisioned services
-				msg := fmt.Sprintf("Container image could not be downloaded: %v", err)
-				log.Warnf(msg)
-				event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
-				me.Add(err)
-				continue
+		service := service
+		t := task{
+			action:  actionStart,
+			name:    service.ServiceName,
+			version: service.ServiceVersion,
+			typ:     dao.ServiceTypeContainer,
+			steps:   containerStartSteps(service.ServiceName, service.ServiceVersion),
+			fn: func() error {
+				err := startContainer(service)
+				crashes.started(service.ServiceName, service.ServiceVersion, err)
+				return err
+			},
+		}
+
+		if ok, retryAt := p.shouldStart(service.ServiceName, service.ServiceVersion); !ok {
+			p.skip(t, fmt.Sprintf("Backing off after failures until %v", retryAt.Format(time.RFC3339)))
+			if rt, ok := p.rollbackTask(service, func(ps *dao.ProvisionedService) bool {
+				return container.IsRunning(combineNameVersion(ps.ServiceName, ps.ServiceVersion))
+			}, startContainer); ok {
+				rt.steps = containerStartSteps(rt.name, rt.version)
+				p.add(rt)
 			}
-			log.Debugf("Downloaded image: %s:%s!", service.ServiceName, version)
+			continue
 		}
 
-		if err := container.Start(service.ServiceName, version, nil); err != nil {
-			msg := fmt.Sprintf("Container could not be started: %v", err)
+		p.add(t)
+	}
+}
+
+// containerStartSteps describes starting a container
+func containerStartSteps(name string, version uint64) []string {
+	var steps []string
+	if !container.IsDownloaded(name, strconv.Itoa(int(version))) {
+		steps = append(steps, stepDownload)
+	}
+	return append(steps, stepStartContainer)
+}
+
+func startContainer(service *dao.ProvisionedService) error {
+	version := strconv.Itoa(int(service.ServiceVersion))
+
+	// Load the service dependencies
+	// We need to expose extra functionality for that
+	// if err := deps.Load(service.ServiceName); err != nil {
+	// 	log.Criticalf("Failed to load dependencies for service %s: %v", service.ServiceName, err)
+	// }
+	log.Debugf("Container %s:%s is not yet running", service.ServiceName, version)
+	if !container.IsDownloaded(service.ServiceName, version) {
+		log.Debugf("Container %s:%s is not yet downloaded", service.ServiceName, version)
+		err := container.Download(service.ServiceName, version)
+		if err != nil {
+			// log error and continue, so we don't block other provisioned services
+			msg := fmt.Sprintf("Container image could not be downloaded: %v", err)
 			log.Warnf(msg)
 			event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
-			me.Add(err)
-			continue
+			return err
 		}
+		log.Debugf("Downloaded image: %s:%s!", service.ServiceName, version)
+	}
 
-		log.Debugf("Started container %s:%s!", service.ServiceName, version)
-		event.Provisioned(service.ServiceName, service.ServiceVersion)
+	conf := &container.Config{
+		Command: service.Args,
+		Env:     service.Env,
+		Memory:  int(service.Memory),
+		CPU:     int(service.CPU),
+	}
+	if err := container.Start(service.ServiceName, version, conf); err != nil {
+		msg := fmt.Sprintf("Container could not be started: %v", err)
+		log.Warnf(msg)
+		event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
+		return err
 	}
 
-	if me.AnyErrors() {
-		return me
+	name := combineNameVersion(service.ServiceName, service.ServiceVersion)
+	if err := health.WaitReady(service, func() bool { return container.IsRunning(name) }); err != nil {
+		msg := fmt.Sprintf("Container did not become ready: %v", err)
+		log.Warnf(msg)
+		event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
+		// stop it so it is retried, rather than left running unready
+		if err := container.Stop(name, 0); err != nil {
+			log.Warnf("Failed to stop container %s after it did not become ready: %v", name, err)
+		}
+		return err
 	}
 
+	log.Debugf("Started container %s:%s!", service.ServiceName, version)
+	event.Provisioned(service.ServiceName, service.ServiceVersion)
 	return nil
 }
 
-func stopExtraContainers(provisionedServices dao.ProvisionedServices) error {
+func stopExtraContainers(provisionedServices, suspendedServices dao.ProvisionedServices, r *Report) error {
 	// stop any services that are running but shouldn't be
 	runningContainerNames, err := container.ListRunning("com.HailoOSS")
 	if err != nil {
 		return err
 	}
 
-	me := multierror.New()
+	p := newPlanner(true, suspendedServices)
+	// stop dependents first; cycles were reported when starting
+	p.order = newServiceOrder(provisionedServices.OfType(dao.ServiceTypeContainer))
+	p.containerStops(provisionedServices, runningContainerNames)
+	p.run(r)
+	return nil
+}
 
+// containerStops plans stopping running containers which aren't provisioned
+func (p *planner) containerStops(provisionedServices dao.ProvisionedServices, runningContainerNames []string) {
 	for _, runningContainerName := range runningContainerNames {
 		runningName, runningVersion, err := splitProcessName(runningContainerName)
 		if err != nil {
-			me.Add(err)
+			p.error(err)
 			continue
 		}
 
@@ -86,22 +155,52 @@ func stopExtraContainers(provisionedServices dao.ProvisionedServices) error {
 			continue
 		}
 
-		if err := container.Stop(runningContainerName, 0); err != nil {
-			msg := fmt.Sprintf("Container %s could not be stopped: %v", runningContainerName, err)
-			log.Warnf(msg)
-			event.DeprovisionError(runningName, runningVersion, msg)
-			me.Add(err)
+		runningContainerName := runningContainerName
+		t := task{
+			action:  actionStop,
+			name:    runningName,
+			version: runningVersion,
+			typ:     dao.ServiceTypeContainer,
+			steps:   []string{stepStopContainer},
+			fn: func() error {
+				return stopContainer(runningContainerName, runningName, runningVersion)
+			},
+		}
+
+		if p.suspended.Contains(runningName, runningVersion, dao.ServiceTypeContainer) {
+			p.suspend(t)
+			continue
+		}
+
+		if p.holdUpgrade(t, provisionedServices, func(ps *dao.ProvisionedService) bool {
+			return container.IsRunning(combineNameVersion(ps.ServiceName, ps.ServiceVersion))
+		}) {
+			continue
+		}
+
+		if provisionedServices.Replacement(runningName, runningVersion, dao.ServiceTypeContainer) == nil {
+			p.deprovision(t)
 			continue
 		}
 
-		log.Debugf("Stopped container %s", runningContainerName)
-		event.Deprovisioned(runningName, runningVersion)
+		p.add(t)
 	}
 
-	if me.AnyErrors() {
-		return me
+	p.addSuspensions()
+	p.addDeprovisions(dao.ServiceTypeContainer, len(runningContainerNames))
+}
+
+func stopContainer(runningContainerName, runningName string, runningVersion uint64) error {
+	if err := container.Stop(runningContainerName, 0); err != nil {
+		msg := fmt.Sprintf("Container %s could not be stopped: %v", runningContainerName, err)
+		log.Warnf(msg)
+		event.DeprovisionError(runningName, runningVersion, msg)
+		return err
 	}
 
+	log.Debugf("Stopped container %s", runningContainerName)
+	crashes.forget(runningName, runningVersion)
+	event.Deprovisioned(runningName, runningVersion)
 	return nil
 }
 
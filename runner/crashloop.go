@@ -0,0 +1,215 @@
+package runner
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/event"
+)
+
+const (
+	// a service must be seen up for minUptime before an exit stops counting as
+	// a crash
+	minUptime = time.Minute
+	// crashLoopThreshold consecutive failures mark a service as crash-looping
+	crashLoopThreshold = 3
+	minRetryBackoff    = 10 * time.Second
+	maxRetryBackoff    = 10 * time.Minute
+)
+
+var (
+	crashes = newCrashTracker()
+)
+
+// startState tracks the start attempts of a single service
+type startState struct {
+	failures     int
+	lastStarted  time.Time
+	retryAt      time.Time
+	crashLooping bool
+	// holdingUpgrade is set once we've reported keeping the previous version
+	// running because this one is failing
+	holdingUpgrade bool
+}
+
+// crashTracker backs off starting services which keep failing to start or
+// exit soon after starting
+type crashTracker struct {
+	mtx      sync.Mutex
+	services map[string]*startState
+}
+
+func newCrashTracker() *crashTracker {
+	return &crashTracker{
+		services: make(map[string]*startState),
+	}
+}
+
+func (c *crashTracker) state(name string, version uint64) *startState {
+	key := combineNameVersion(name, version)
+	s, ok := c.services[key]
+	if !ok {
+		s = &startState{}
+		c.services[key] = s
+	}
+	return s
+}
+
+// crashWindow is how long after starting an exit counts as a crash. We only
+// notice an exit at the next check, which may be a whole poll later, so the
+// window allows for that on top of minUptime. Services seen running for
+// minUptime are forgotten before then.
+func crashWindow() time.Duration {
+	return minUptime + time.Duration(float64(pollInterval())*(1+pollJitter)) + debounceDelay
+}
+
+// retryBackoff is how long to wait after a number of consecutive failures
+func retryBackoff(failures int) time.Duration {
+	backoff := minRetryBackoff
+	for i := 1; i < failures && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
+
+// fail records a failure and works out when to next try
+func (c *crashTracker) fail(s *startState, name string, version uint64, reason string) {
+	s.failures++
+
+	backoff := retryBackoff(s.failures)
+	s.retryAt = time.Now().Add(backoff)
+
+	if s.failures < crashLoopThreshold {
+		return
+	}
+
+	s.crashLooping = true
+	info := fmt.Sprintf("%s; %d consecutive failures, next retry in %v", reason, s.failures, backoff)
+	log.Warnf("Service %s-%d is crash-looping: %s", name, version, info)
+	event.CrashLooping(name, version, info)
+}
+
+// notRunning is called when a service should be running but isn't. It
+// returns whether we should try to start it now, or when we will next try.
+func (c *crashTracker) notRunning(name string, version uint64) (bool, time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s := c.state(name, version)
+
+	// we started it before, and it has since exited
+	if !s.lastStarted.IsZero() {
+		uptime := time.Since(s.lastStarted)
+		s.lastStarted = time.Time{}
+
+		if uptime < crashWindow() {
+			c.fail(s, name, version, fmt.Sprintf("exited within %v of starting", uptime))
+		} else {
+			s.failures = 0
+			s.crashLooping = false
+			s.holdingUpgrade = false
+		}
+	}
+
+	if time.Now().Before(s.retryAt) {
+		return false, s.retryAt
+	}
+
+	return true, s.retryAt
+}
+
+// wouldStart returns what notRunning would, without recording anything
+func (c *crashTracker) wouldStart(name string, version uint64) (bool, time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s, ok := c.services[combineNameVersion(name, version)]
+	if !ok {
+		return true, time.Time{}
+	}
+
+	retryAt := s.retryAt
+	if !s.lastStarted.IsZero() && time.Since(s.lastStarted) < crashWindow() {
+		retryAt = time.Now().Add(retryBackoff(s.failures + 1))
+	}
+
+	if time.Now().Before(retryAt) {
+		return false, retryAt
+	}
+	return true, retryAt
+}
+
+// running is called when a service is seen running, and clears its failures
+// once it has stayed up long enough. It returns whether the service is stable.
+func (c *crashTracker) running(name string, version uint64) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	key := combineNameVersion(name, version)
+	s, ok := c.services[key]
+	if !ok {
+		return true
+	}
+
+	if s.lastStarted.IsZero() || time.Since(s.lastStarted) < minUptime {
+		return false
+	}
+
+	if s.crashLooping {
+		log.Infof("Service %s has recovered after %d failures", key, s.failures)
+	}
+
+	delete(c.services, key)
+	return true
+}
+
+// started records the result of trying to start a service
+func (c *crashTracker) started(name string, version uint64, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s := c.state(name, version)
+	if err != nil {
+		c.fail(s, name, version, err.Error())
+		return
+	}
+
+	s.lastStarted = time.Now()
+}
+
+// holdingUpgrade records that the previous version of a failing service is
+// being kept, returning whether this is new
+func (c *crashTracker) holdingUpgrade(name string, version uint64) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s := c.state(name, version)
+	if s.holdingUpgrade {
+		return false
+	}
+
+	s.holdingUpgrade = true
+	return true
+}
+
+// failing returns whether the last attempts to start a service failed
+func (c *crashTracker) failing(name string, version uint64) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s, ok := c.services[combineNameVersion(name, version)]
+	return ok && s.failures > 0
+}
+
+// forget drops the state of a service which is no longer provisioned
+func (c *crashTracker) forget(name string, version uint64) {
+	c.mtx.Lock()
+	delete(c.services, combineNameVersion(name, version))
+	c.mtx.Unlock()
+}
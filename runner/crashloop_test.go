@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCrashTracker(t *testing.T) {
+	c := newCrashTracker()
+	name, version := "com.HailoOSS.service.foo", uint64(20130618183200)
+
+	if ok, _ := c.notRunning(name, version); !ok {
+		t.Fatal("Expected to start a service we have never started")
+	}
+
+	var lastBackoff time.Duration
+	for i := 1; i <= crashLoopThreshold; i++ {
+		// it starts, then exits straight away
+		c.started(name, version, nil)
+		ok, retryAt := c.notRunning(name, version)
+		if ok {
+			t.Fatalf("Expected to back off after %d crashes", i)
+		}
+
+		backoff := retryAt.Sub(time.Now())
+		if backoff <= lastBackoff {
+			t.Errorf("Expected backoff to increase after %d crashes, got %v after %v", i, backoff, lastBackoff)
+		}
+		lastBackoff = backoff
+
+		// pretend the backoff has passed
+		c.services[combineNameVersion(name, version)].retryAt = time.Now()
+	}
+
+	if !c.services[combineNameVersion(name, version)].crashLooping {
+		t.Errorf("Expected service to be crash-looping after %d crashes", crashLoopThreshold)
+	}
+
+	// failing to start counts too
+	c.started(name, version, fmt.Errorf("download failed"))
+	if ok, _ := c.notRunning(name, version); ok {
+		t.Error("Expected to back off after failing to start")
+	}
+
+	// once it stays up it is forgotten
+	c.services[combineNameVersion(name, version)].lastStarted = time.Now().Add(-minUptime)
+	c.running(name, version)
+	if _, ok := c.services[combineNameVersion(name, version)]; ok {
+		t.Error("Expected failures to be cleared once the service stayed up")
+	}
+}
+
+func TestCrashTrackerMaxBackoff(t *testing.T) {
+	c := newCrashTracker()
+	name, version := "com.HailoOSS.service.foo", uint64(20130618183200)
+
+	for i := 0; i < 100; i++ {
+		c.started(name, version, fmt.Errorf("start failed"))
+	}
+
+	if backoff := c.services[combineNameVersion(name, version)].retryAt.Sub(time.Now()); backoff > maxRetryBackoff {
+		t.Errorf("Expected backoff to be capped at %v, got %v", maxRetryBackoff, backoff)
+	}
+}
+
+func TestCrashTrackerHoldingUpgrade(t *testing.T) {
+	c := newCrashTracker()
+	name, version := "com.HailoOSS.service.foo", uint64(2)
+
+	if !c.holdingUpgrade(name, version) {
+		t.Error("Expected the first hold of an upgrade to be new")
+	}
+	if c.holdingUpgrade(name, version) {
+		t.Error("Expected holding the same upgrade again not to be new")
+	}
+
+	c.forget(name, version)
+	if !c.holdingUpgrade(name, version) {
+		t.Error("Expected a hold after the version recovered to be new")
+	}
+}
+
+func TestCrashTrackerSlowPoll(t *testing.T) {
+	c := newCrashTracker()
+	name, version := "com.HailoOSS.service.foo", uint64(20130618183200)
+
+	// it exited soon after starting, but we only noticed at the next poll
+	c.started(name, version, nil)
+	c.services[combineNameVersion(name, version)].lastStarted = time.Now().Add(-minUptime - pollInterval())
+	if ok, _ := c.notRunning(name, version); ok {
+		t.Error("Expected an exit noticed at the next poll to count as a crash")
+	}
+
+	// it was seen running for long enough, so a later exit isn't a crash
+	c.services[combineNameVersion(name, version)].retryAt = time.Now()
+	c.started(name, version, nil)
+	c.services[combineNameVersion(name, version)].lastStarted = time.Now().Add(-minUptime)
+	c.running(name, version)
+	if ok, _ := c.notRunning(name, version); !ok {
+		t.Error("Expected an exit after staying up not to count as a crash")
+	}
+}
@@ -0,0 +1,233 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HailoOSS/service/config"
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/event"
+)
+
+const (
+	defaultGuardMaxStops    = 10
+	defaultGuardMaxFraction = 0.5
+	defaultGuardWindow      = 10 * time.Minute
+	// how long confirmed stops may go ahead for
+	confirmExpiry = 10 * time.Minute
+)
+
+var (
+	guard = newStopGuard()
+)
+
+// stopGuard limits how many services are deprovisioned in a window of time,
+// in case provisioning manager returns an empty or truncated list of what
+// should be running. Past the limit stops are held until they're confirmed.
+type stopGuard struct {
+	mtx sync.Mutex
+	// recent deprovisions, by service version
+	stops map[string]time.Time
+	// held deprovisions, and the type of service
+	held map[string]dao.ServiceType
+	// confirmed deprovisions, and when the confirmation expires
+	confirmed map[string]time.Time
+}
+
+func newStopGuard() *stopGuard {
+	return &stopGuard{
+		stops:     make(map[string]time.Time),
+		held:      make(map[string]dao.ServiceType),
+		confirmed: make(map[string]time.Time),
+	}
+}
+
+// guardLimits reads the limits from config at
+// hailo.service.provisioning.stopGuard, so they can be changed at runtime
+func guardLimits() (int, float64, time.Duration) {
+	maxStops := config.AtPath("hailo", "service", "provisioning", "stopGuard", "maxStops").AsInt(defaultGuardMaxStops)
+	if maxStops < 1 {
+		maxStops = defaultGuardMaxStops
+	}
+
+	maxFraction := config.AtPath("hailo", "service", "provisioning", "stopGuard", "maxFraction").AsFloat64(defaultGuardMaxFraction)
+	if maxFraction <= 0 || maxFraction > 1 {
+		maxFraction = defaultGuardMaxFraction
+	}
+
+	window := config.AtPath("hailo", "service", "provisioning", "stopGuard", "window").AsDuration(defaultGuardWindow.String())
+	if window <= 0 {
+		window = defaultGuardWindow
+	}
+
+	return maxStops, maxFraction, window
+}
+
+// hold returns which of the service versions of a type about to be
+// deprovisioned must wait for confirmation. It trips when, with the
+// deprovisions in the window, more than maxStops services would be stopped, or
+// more than one and over maxFraction of the running services. Stops already
+// let through are not held. Only live plans are recorded.
+func (g *stopGuard) hold(typ dao.ServiceType, keys []string, running int, live bool) map[string]bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	maxStops, maxFraction, window := guardLimits()
+	now := time.Now()
+	g.expire(now, window)
+
+	var pending []string
+	for _, key := range keys {
+		if _, ok := g.stops[key]; ok {
+			continue
+		}
+		if _, ok := g.confirmed[key]; ok {
+			continue
+		}
+		pending = append(pending, key)
+	}
+
+	stops := len(g.stops) + len(pending)
+	tripped := stops > maxStops || (stops > 1 && float64(stops) > maxFraction*float64(running+len(g.stops)))
+
+	held := make(map[string]bool)
+	if tripped {
+		for _, key := range pending {
+			held[key] = true
+		}
+	}
+
+	if !live {
+		return held
+	}
+
+	var added []string
+	for key, t := range g.held {
+		if t == typ && !held[key] {
+			delete(g.held, key)
+		}
+	}
+	for key := range held {
+		if _, ok := g.held[key]; !ok {
+			added = append(added, key)
+		}
+		g.held[key] = typ
+	}
+
+	if !tripped {
+		for _, key := range pending {
+			g.stops[key] = now
+		}
+	}
+
+	if len(added) > 0 {
+		sort.Strings(added)
+		info := fmt.Sprintf("Holding %d stops, of %d running services and %d stopped in the last %v, until they're confirmed: %s",
+			len(held), running, len(g.stops), window, strings.Join(added, ", "))
+		log.Critical(info)
+		event.StopsHeld(info)
+	}
+
+	return held
+}
+
+// expire forgets stops outside the window and expired confirmations
+func (g *stopGuard) expire(now time.Time, window time.Duration) {
+	for key, at := range g.stops {
+		if now.Sub(at) > window {
+			delete(g.stops, key)
+		}
+	}
+	for key, until := range g.confirmed {
+		if now.After(until) {
+			delete(g.confirmed, key)
+		}
+	}
+}
+
+// confirm lets held stops go ahead, returning them
+func (g *stopGuard) confirm() []string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	var keys []string
+	until := time.Now().Add(confirmExpiry)
+	for key := range g.held {
+		g.confirmed[key] = until
+		keys = append(keys, key)
+	}
+	g.held = make(map[string]dao.ServiceType)
+
+	sort.Strings(keys)
+	return keys
+}
+
+// heldStops returns the stops waiting for confirmation
+func (g *stopGuard) heldStops() []string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	var keys []string
+	for key := range g.held {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// HeldStops returns the service versions whose stops are held by the stop
+// guard
+func HeldStops() []string {
+	return guard.heldStops()
+}
+
+// ConfirmStops lets the stops held by the stop guard go ahead, checking
+// services straight away. It returns the service versions confirmed.
+func ConfirmStops(user string) []string {
+	keys := guard.confirm()
+	if len(keys) > 0 {
+		log.Warnf("Stops confirmed by %s: %s", user, strings.Join(keys, ", "))
+		Trigger("", "stops confirmed")
+	}
+	return keys
+}
+
+// deprovision plans stopping a service which is no longer provisioned at
+// any version
+func (p *planner) deprovision(t task) {
+	p.deprovisions = append(p.deprovisions, t)
+}
+
+// addDeprovisions adds the planned deprovisions of a type, holding them if
+// the stop guard trips
+func (p *planner) addDeprovisions(typ dao.ServiceType, running int) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, t := range p.deprovisions {
+		key := combineNameVersion(t.name, t.version)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	held := guard.hold(typ, keys, running, p.live)
+	for _, t := range p.deprovisions {
+		if held[combineNameVersion(t.name, t.version)] {
+			p.skip(t, "held by the stop guard until confirmed")
+		} else {
+			p.add(t)
+		}
+	}
+	if len(held) > 0 {
+		p.error(fmt.Errorf("Stop guard holding %d of %d deprovisions until confirmed", len(held), len(keys)))
+	}
+
+	p.deprovisions = nil
+}
@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+func TestStopGuard(t *testing.T) {
+	defer func(g *stopGuard) { guard = g }(guard)
+	guard = newStopGuard()
+
+	if held := guard.hold(dao.ServiceTypeProcess, []string{"com.HailoOSS.service.a-1"}, 2, true); len(held) != 0 {
+		t.Errorf("Expected one deprovision to go ahead, got %v held", held)
+	}
+
+	// the rest of what's running, as if provisioning manager returned nothing
+	keys := []string{"com.HailoOSS.service.a-1", "com.HailoOSS.service.b-1"}
+	held := guard.hold(dao.ServiceTypeProcess, keys, 1, false)
+	if len(held) != 1 || !held["com.HailoOSS.service.b-1"] {
+		t.Errorf("Expected b to be held, got %v", held)
+	}
+	if len(HeldStops()) != 0 {
+		t.Error("Expected plans which aren't live not to hold stops")
+	}
+
+	guard.hold(dao.ServiceTypeProcess, keys, 1, true)
+	if stops := HeldStops(); len(stops) != 1 || stops[0] != "com.HailoOSS.service.b-1" {
+		t.Fatalf("Expected b to be held, got %v", stops)
+	}
+
+	if confirmed := guard.confirm(); len(confirmed) != 1 {
+		t.Errorf("Expected b to be confirmed, got %v", confirmed)
+	}
+	if held := guard.hold(dao.ServiceTypeProcess, keys, 1, true); len(held) != 0 {
+		t.Errorf("Expected confirmed stops to go ahead, got %v held", held)
+	}
+}
+
+func TestPlanHoldsDeprovisions(t *testing.T) {
+	defer func(g *stopGuard) { guard = g }(guard)
+	guard = newStopGuard()
+
+	p := newPlanner(false, nil)
+	p.processStops(nil, []string{
+		"/etc/init/com.HailoOSS.service.a-1",
+		"/etc/init/com.HailoOSS.service.b-1",
+		"/etc/init/com.HailoOSS.service.c-1",
+	})
+
+	for _, task := range p.tasks {
+		if task.skip == "" {
+			t.Errorf("Expected the stop of %s to be held", task.name)
+		}
+	}
+	if len(p.errors) != 1 {
+		t.Errorf("Expected the guard tripping to be reported, got %v", p.errors)
+	}
+}
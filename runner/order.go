@@ -0,0 +1,200 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+var (
+	// ranks of every service seen, so services which are no longer
+	// provisioned are still stopped in order
+	knownRanks = &rankStore{ranks: make(map[string]rank)}
+)
+
+// rank orders the start of a service: services start in order of rank, and
+// stop in reverse
+type rank struct {
+	// priority tier, higher first
+	priority int
+	// how many services within the tier must start first
+	depth int
+}
+
+func (a rank) before(b rank) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	return a.depth < b.depth
+}
+
+// serviceOrder ranks provisioned services so that each starts after the
+// services it declares it comes after, and after higher priority tiers. A
+// service can't be in a higher tier than a service it comes after.
+type serviceOrder struct {
+	ranks  map[string]rank
+	after  map[string][]string
+	cycles [][]string
+}
+
+func newServiceOrder(services dao.ProvisionedServices) *serviceOrder {
+	o := &serviceOrder{
+		ranks: make(map[string]rank),
+		after: make(map[string][]string),
+	}
+
+	byName := make(map[string]*dao.ProvisionedService)
+	var names []string
+	for _, service := range services {
+		if _, ok := byName[service.ServiceName]; !ok {
+			names = append(names, service.ServiceName)
+		}
+		byName[service.ServiceName] = service
+	}
+
+	// only dependencies on services provisioned here can be waited for
+	for _, name := range names {
+		for _, dep := range byName[name].After {
+			if _, ok := byName[dep]; ok && dep != name {
+				o.after[name] = append(o.after[name], dep)
+			}
+		}
+	}
+
+	visiting := make(map[string]bool)
+	var path []string
+	var visit func(name string) rank
+	visit = func(name string) rank {
+		if r, ok := o.ranks[name]; ok {
+			return r
+		}
+
+		visiting[name] = true
+		path = append(path, name)
+
+		r := rank{priority: byName[name].Priority}
+		var deps []rank
+		for _, dep := range o.after[name] {
+			if visiting[dep] {
+				o.addCycle(path, dep)
+				continue
+			}
+			d := visit(dep)
+			deps = append(deps, d)
+			if d.priority < r.priority {
+				r.priority = d.priority
+			}
+		}
+		for _, d := range deps {
+			if d.priority == r.priority && d.depth >= r.depth {
+				r.depth = d.depth + 1
+			}
+		}
+
+		path = path[:len(path)-1]
+		visiting[name] = false
+		o.ranks[name] = r
+		return r
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		visit(name)
+	}
+
+	knownRanks.update(o.ranks)
+	return o
+}
+
+// addCycle records the cycle closed by a service on the path depending on
+// one earlier on it
+func (o *serviceOrder) addCycle(path []string, dep string) {
+	for i, name := range path {
+		if name == dep {
+			cycle := append([]string{}, path[i:]...)
+			o.cycles = append(o.cycles, append(cycle, dep))
+			return
+		}
+	}
+}
+
+// cycleErrors describes the dependency cycles found
+func (o *serviceOrder) cycleErrors() []error {
+	var errs []error
+	for _, cycle := range o.cycles {
+		errs = append(errs, fmt.Errorf("Dependency cycle, starting in any order: %s", strings.Join(cycle, " -> ")))
+	}
+	return errs
+}
+
+// batches groups tasks by the rank of their service, in start order or, to
+// stop, in reverse
+func (o *serviceOrder) batches(tasks []task, reverse bool) [][]task {
+	byRank := make(map[rank][]task)
+	var ranks []rank
+	for _, t := range tasks {
+		r := knownRanks.get(t.name)
+		if _, ok := byRank[r]; !ok {
+			ranks = append(ranks, r)
+		}
+		byRank[r] = append(byRank[r], t)
+	}
+
+	sort.Sort(rankSorter{ranks, reverse})
+
+	batches := make([][]task, len(ranks))
+	for i, r := range ranks {
+		batches[i] = byRank[r]
+	}
+	return batches
+}
+
+// waitingFor returns a service which a service comes after and which failed
+// to start, if any
+func (o *serviceOrder) waitingFor(name string, failed map[string]bool) string {
+	for _, dep := range o.after[name] {
+		if failed[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+type rankSorter struct {
+	ranks   []rank
+	reverse bool
+}
+
+func (s rankSorter) Len() int      { return len(s.ranks) }
+func (s rankSorter) Swap(i, j int) { s.ranks[i], s.ranks[j] = s.ranks[j], s.ranks[i] }
+func (s rankSorter) Less(i, j int) bool {
+	if s.reverse {
+		return s.ranks[j].before(s.ranks[i])
+	}
+	return s.ranks[i].before(s.ranks[j])
+}
+
+// rankStore remembers the ranks of services
+type rankStore struct {
+	mtx   sync.RWMutex
+	ranks map[string]rank
+}
+
+func (s *rankStore) update(ranks map[string]rank) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for name, r := range ranks {
+		s.ranks[name] = r
+	}
+}
+
+func (s *rankStore) get(name string) rank {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.ranks[name]
+}
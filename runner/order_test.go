@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+func TestServiceOrder(t *testing.T) {
+	services := dao.ProvisionedServices{
+		{ServiceName: "com.HailoOSS.service.api", ServiceVersion: 1, After: []string{"com.HailoOSS.service.db", "com.HailoOSS.service.missing"}},
+		{ServiceName: "com.HailoOSS.service.db", ServiceVersion: 1},
+		{ServiceName: "com.HailoOSS.service.config", ServiceVersion: 1, Priority: 10},
+		{ServiceName: "com.HailoOSS.service.web", ServiceVersion: 1, Priority: 10, After: []string{"com.HailoOSS.service.api"}},
+	}
+
+	o := newServiceOrder(services)
+	if len(o.cycles) != 0 {
+		t.Fatalf("Expected no cycles, got %v", o.cycles)
+	}
+	if r := o.ranks["com.HailoOSS.service.web"]; r.priority != 0 || r.depth != 2 {
+		t.Errorf("Expected web to take the tier of what it comes after, got %+v", r)
+	}
+
+	var tasks []task
+	for _, name := range []string{"com.HailoOSS.service.web", "com.HailoOSS.service.api", "com.HailoOSS.service.db", "com.HailoOSS.service.config"} {
+		tasks = append(tasks, task{name: name, version: 1, action: actionStart})
+	}
+
+	batches := o.batches(tasks, false)
+	expected := []string{"com.HailoOSS.service.config", "com.HailoOSS.service.db", "com.HailoOSS.service.api", "com.HailoOSS.service.web"}
+	if len(batches) != len(expected) {
+		t.Fatalf("Expected %d batches, got %d", len(expected), len(batches))
+	}
+	for i, name := range expected {
+		if len(batches[i]) != 1 || batches[i][0].name != name {
+			t.Errorf("Expected batch %d to start %s, got %v", i, name, batches[i])
+		}
+	}
+
+	stops := o.batches(tasks, true)
+	for i, name := range expected {
+		if stops[len(stops)-1-i][0].name != name {
+			t.Errorf("Expected %s to stop in reverse order", name)
+		}
+	}
+
+	if dep := o.waitingFor("com.HailoOSS.service.api", map[string]bool{"com.HailoOSS.service.db": true}); dep != "com.HailoOSS.service.db" {
+		t.Errorf("Expected api to wait for db, got %q", dep)
+	}
+}
+
+func TestServiceOrderCycle(t *testing.T) {
+	services := dao.ProvisionedServices{
+		{ServiceName: "com.HailoOSS.service.a", ServiceVersion: 1, After: []string{"com.HailoOSS.service.b"}},
+		{ServiceName: "com.HailoOSS.service.b", ServiceVersion: 1, After: []string{"com.HailoOSS.service.a"}},
+	}
+
+	errs := newServiceOrder(services).cycleErrors()
+	if len(errs) != 1 {
+		t.Fatalf("Expected one cycle, got %v", errs)
+	}
+	expected := errors.New("Dependency cycle, starting in any order: com.HailoOSS.service.a -> com.HailoOSS.service.b -> com.HailoOSS.service.a")
+	if errs[0].Error() != expected.Error() {
+		t.Errorf("Expected %q, got %q", expected, errs[0])
+	}
+}
+
+func TestPlanWaitsForDependencies(t *testing.T) {
+	services := dao.ProvisionedServices{
+		{ServiceName: "com.HailoOSS.service.db", ServiceVersion: 1},
+		{ServiceName: "com.HailoOSS.service.api", ServiceVersion: 1, After: []string{"com.HailoOSS.service.db"}},
+	}
+
+	p := newPlanner(false, nil)
+	p.ordered(services)
+
+	started := false
+	p.add(task{name: "com.HailoOSS.service.db", version: 1, action: actionStart, fn: func() error {
+		return errors.New("failed")
+	}})
+	p.add(task{name: "com.HailoOSS.service.api", version: 1, action: actionStart, fn: func() error {
+		started = true
+		return nil
+	}})
+
+	p.run(newReport())
+	if started {
+		t.Error("Expected api not to start after db failed")
+	}
+}
@@ -0,0 +1,323 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/container"
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/event"
+	"github.com/HailoOSS/provisioning-service/maintenance"
+	"github.com/HailoOSS/provisioning-service/process"
+)
+
+const (
+	stepDownload       = "download"
+	stepVerify         = "verify"
+	stepStart          = "start"
+	stepStop           = "stop"
+	stepDeleteBinary   = "delete binary"
+	stepStartContainer = "start container"
+	stepStopContainer  = "stop container"
+)
+
+var (
+	planMtx  sync.Mutex
+	lastPlan string
+)
+
+// planner works out the tasks which bring what is running in line with what
+// is provisioned. Live plans are carried out, so while making them the
+// planner also records what it sees of running services, such as which
+// versions have stayed up. Other plans only look.
+type planner struct {
+	live bool
+	// suspended services are provisioned, but not at the current run level
+	suspended dao.ProvisionedServices
+	// order services start and stop in, if it matters
+	order        *serviceOrder
+	tasks        []task
+	suspensions  []task
+	deprovisions []task
+	errors       []error
+}
+
+func newPlanner(live bool, suspended dao.ProvisionedServices) *planner {
+	return &planner{live: live, suspended: suspended}
+}
+
+// ordered makes the plan start services after the services they depend on,
+// and stop them before
+func (p *planner) ordered(services dao.ProvisionedServices) {
+	p.order = newServiceOrder(services)
+	for _, err := range p.order.cycleErrors() {
+		p.error(err)
+	}
+
+	if p.live {
+		for _, cycle := range p.order.cycles {
+			msg := fmt.Sprintf("Dependency cycle: %s", strings.Join(cycle, " -> "))
+			for _, service := range services {
+				if service.ServiceName == cycle[0] {
+					event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
+				}
+			}
+		}
+	}
+}
+
+func (p *planner) add(t task) {
+	p.tasks = append(p.tasks, t)
+}
+
+// skip adds a task which won't be carried out yet, and why
+func (p *planner) skip(t task, reason string) {
+	t.skip = reason
+	p.tasks = append(p.tasks, t)
+}
+
+func (p *planner) error(err error) {
+	p.errors = append(p.errors, err)
+}
+
+// shouldStart returns whether a service which isn't running should be
+// started now, or when it will next be
+func (p *planner) shouldStart(name string, version uint64) (bool, time.Time) {
+	if p.live {
+		return crashes.notRunning(name, version)
+	}
+	return crashes.wouldStart(name, version)
+}
+
+// batches splits the plan into tasks which can run at once, with starts in
+// order, then stops in reverse order
+func (p *planner) batches() [][]task {
+	if p.order == nil {
+		return [][]task{p.tasks}
+	}
+
+	var starts, stops []task
+	for _, t := range p.tasks {
+		if t.action == actionStop {
+			stops = append(stops, t)
+		} else {
+			starts = append(starts, t)
+		}
+	}
+
+	return append(p.order.batches(starts, false), p.order.batches(stops, true)...)
+}
+
+// run carries out the plan, a batch at a time. A service isn't started if a
+// service it comes after failed to start.
+func (p *planner) run(r *Report) {
+	for _, err := range p.errors {
+		r.error(err)
+	}
+
+	var mtx sync.Mutex
+	failed := make(map[string]bool)
+
+	for _, batch := range p.batches() {
+		var tasks []task
+		for _, t := range batch {
+			if t.action == actionStop {
+				tasks = append(tasks, t)
+				continue
+			}
+
+			mtx.Lock()
+			dep := ""
+			if p.order != nil {
+				dep = p.order.waitingFor(t.name, failed)
+			}
+			if dep != "" || t.skip != "" {
+				failed[t.name] = true
+			}
+			mtx.Unlock()
+
+			if dep != "" {
+				r.skipped(t, fmt.Sprintf("waiting for %s to start", dep))
+				continue
+			}
+
+			if t.skip != "" {
+				tasks = append(tasks, t)
+				continue
+			}
+
+			fn, name := t.fn, t.name
+			t.fn = func() error {
+				err := fn()
+				if err != nil {
+					mtx.Lock()
+					failed[name] = true
+					mtx.Unlock()
+				}
+				return err
+			}
+			tasks = append(tasks, t)
+		}
+
+		workers.run(tasks, r)
+	}
+}
+
+// PlannedAction is something a check would do to a service
+type PlannedAction struct {
+	ServiceName    string
+	ServiceVersion uint64
+	Instance       int
+	ServiceType    dao.ServiceType
+	Action         string
+	Steps          []string
+	// Skipped is why the action won't be carried out yet, if it won't
+	Skipped string
+}
+
+func (a *PlannedAction) String() string {
+	desc := fmt.Sprintf("%s %s", a.Action, process.InstanceName(a.ServiceName, a.ServiceVersion, a.Instance))
+	if len(a.Steps) > 0 {
+		desc += " (" + strings.Join(a.Steps, ", ") + ")"
+	}
+	if a.Skipped != "" {
+		desc += " skipped: " + a.Skipped
+	}
+	return desc
+}
+
+// Plan is what a check would do on this host, worked out from the
+// provisioned services and what is running. Stops of old versions which wait
+// for their replacement to start are planned as skipped, since the
+// replacement isn't running yet.
+type Plan struct {
+	Created time.Time
+	Actions []*PlannedAction
+	Errors  []string
+}
+
+func (p *Plan) String() string {
+	var lines []string
+	for _, a := range p.Actions {
+		lines = append(lines, a.String())
+	}
+	for _, err := range p.Errors {
+		lines = append(lines, "error: "+err)
+	}
+	if len(lines) == 0 {
+		return "nothing to do"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NewPlan works out what a check would do now, without doing anything. It
+// plans from the services last loaded, so it doesn't change the cache.
+func NewPlan() (*Plan, error) {
+	services, err := dao.CachedServices(myClass)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching provisioned services list: %v", err)
+	}
+
+	m, err := maintenance.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	levels.refresh(services)
+	services, suspended := levels.apply(services)
+	p := newPlanner(false, suspended)
+	plan := &Plan{Created: time.Now()}
+
+	if m != nil && m.All() {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("Paused for maintenance of %v", m))
+		return plan, nil
+	}
+
+	p.ordered(services)
+
+	stale := staleCache()
+	if stale != nil {
+		p.error(stale)
+	}
+
+	if running, err := process.ListRunning("com.HailoOSS"); err != nil {
+		p.error(fmt.Errorf("Error listing running services: %v", err))
+	} else {
+		p.processStarts(services, running)
+		if stale == nil {
+			p.processStops(services, running)
+		}
+	}
+
+	if docker {
+		if running, err := container.ListRunning("com.HailoOSS"); err != nil {
+			p.error(fmt.Errorf("Error listing running containers: %v", err))
+		} else {
+			p.containerStarts(services)
+			if stale == nil {
+				p.containerStops(services, running)
+			}
+		}
+	}
+
+	if m == nil && stale == nil {
+		p.binaryDeletes(append(services, suspended...))
+	}
+
+	var tasks []task
+	for _, batch := range p.batches() {
+		tasks = append(tasks, batch...)
+	}
+
+	for _, t := range tasks {
+		if m.Pauses(t.name) {
+			t.skip = "paused for maintenance"
+		}
+
+		plan.Actions = append(plan.Actions, &PlannedAction{
+			ServiceName:    t.name,
+			ServiceVersion: t.version,
+			Instance:       t.instance,
+			ServiceType:    t.typ,
+			Action:         t.action,
+			Steps:          t.steps,
+			Skipped:        t.skip,
+		})
+	}
+	for _, err := range p.errors {
+		plan.Errors = append(plan.Errors, err.Error())
+	}
+
+	return plan, nil
+}
+
+// dryRun logs what a check would do, when it changes. Like a check, it loads
+// the provisioned services first.
+func dryRun() {
+	if _, err := dao.Services(myClass); err != nil {
+		log.Errorf("Error fetching provisioned services list: %v", err)
+		return
+	}
+
+	plan, err := NewPlan()
+	if err != nil {
+		log.Errorf("Error planning: %v", err)
+		return
+	}
+
+	planMtx.Lock()
+	defer planMtx.Unlock()
+
+	desc := plan.String()
+	if desc == lastPlan {
+		log.Debugf("Dry run, plan unchanged")
+		return
+	}
+	lastPlan = desc
+
+	log.Infof("Dry run, would:\n%s", desc)
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/process"
+)
+
+func TestPlanProcesses(t *testing.T) {
+	services := dao.ProvisionedServices{
+		{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 1},
+		{ServiceName: "com.HailoOSS.service.bar", ServiceVersion: 1},
+	}
+	running := []string{
+		"/etc/init/com.HailoOSS.service.bar-1",
+		"/etc/init/com.HailoOSS.service.bar-1@1",
+		"/etc/init/com.HailoOSS.service.baz-1",
+	}
+
+	// a plan only looks, so it mustn't count this as a crash
+	crashes.started("com.HailoOSS.service.foo", 1, nil)
+	defer crashes.forget("com.HailoOSS.service.foo", 1)
+
+	p := newPlanner(false, nil)
+	p.processStarts(services, running)
+	p.processStops(services, running)
+
+	var planned []string
+	for _, t := range p.tasks {
+		planned = append(planned, t.action+" "+process.InstanceName(t.name, t.version, t.instance))
+	}
+
+	expected := []string{
+		"start com.HailoOSS.service.foo-1@0",
+		"stop com.HailoOSS.service.bar-1@1",
+		"stop com.HailoOSS.service.baz-1@0",
+	}
+	if !reflect.DeepEqual(planned, expected) {
+		t.Fatalf("Expected plan %q, got %q", expected, planned)
+	}
+
+	if !strings.HasPrefix(p.tasks[0].skip, "Backing off") || p.tasks[1].skip != "" || p.tasks[2].skip != "" {
+		t.Errorf("Expected only the crashed service to be skipped, got %q %q %q", p.tasks[0].skip, p.tasks[1].skip, p.tasks[2].skip)
+	}
+
+	if steps := p.tasks[0].steps; len(steps) < 2 || steps[len(steps)-2] != stepVerify || steps[len(steps)-1] != stepStart {
+		t.Errorf("Expected a start to verify and start, got %v", steps)
+	}
+
+	if s := crashes.services[combineNameVersion("com.HailoOSS.service.foo", 1)]; s.failures != 0 || s.lastStarted.IsZero() {
+		t.Errorf("Expected planning not to record a crash, got %+v", s)
+	}
+}
@@ -0,0 +1,182 @@
+package runner
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+// task is a single action on a service
+type task struct {
+	action   string
+	name     string
+	version  uint64
+	instance int
+	typ      dao.ServiceType
+	// steps describe what fn does, for plans
+	steps []string
+	// skip is why the task won't run yet, if it won't
+	skip string
+	fn   func() error
+}
+
+// key identifies the service a task acts on. Instances of a service share
+// a key, since starting a service starts all of its missing instances.
+func (t task) key() string {
+	return combineNameVersion(t.name, t.version)
+}
+
+// pool runs tasks with bounded concurrency, never running two tasks for the
+// same key at once
+type pool struct {
+	timeout time.Duration
+	slots   chan struct{}
+
+	mtx  sync.Mutex
+	busy map[string]bool
+}
+
+func newPool(concurrency int, timeout time.Duration) *pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &pool{
+		timeout: timeout,
+		slots:   make(chan struct{}, concurrency),
+		busy:    make(map[string]bool),
+	}
+}
+
+func (p *pool) lock(key string) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.busy[key] {
+		return false
+	}
+
+	p.busy[key] = true
+	return true
+}
+
+// isBusy returns whether a task for a key is running, including one which
+// timed out but hasn't finished
+func (p *pool) isBusy(key string) bool {
+	if p == nil {
+		return false
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.busy[key]
+}
+
+// anyBusy returns whether any task is running
+func (p *pool) anyBusy() bool {
+	if p == nil {
+		return false
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return len(p.busy) > 0
+}
+
+func (p *pool) unlock(key string) {
+	p.mtx.Lock()
+	delete(p.busy, key)
+	p.mtx.Unlock()
+}
+
+// run runs the tasks, recording their outcome in the report, and waits for
+// them all to finish or time out. Tasks for the same service run one after
+// another. Tasks for services which are still busy, e.g. from a timed out
+// task in an earlier run, are skipped.
+func (p *pool) run(tasks []task, r *Report) {
+	var keys []string
+	byKey := make(map[string][]task)
+
+	for _, t := range tasks {
+		if t.skip != "" {
+			r.skipped(t, t.skip)
+			continue
+		}
+
+		if r.maintenance.Pauses(t.name) {
+			r.skipped(t, "paused for maintenance")
+			continue
+		}
+
+		key := t.key()
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], t)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, key := range keys {
+		if !p.lock(key) {
+			for _, t := range byKey[key] {
+				r.skipped(t, "still busy from an earlier check")
+			}
+			continue
+		}
+
+		p.slots <- struct{}{}
+		wg.Add(1)
+		go func(key string, tasks []task) {
+			defer wg.Done()
+			defer func() {
+				<-p.slots
+			}()
+
+			for i, t := range tasks {
+				finished, err := p.exec(t)
+				if err != nil {
+					r.failed(t, err)
+				} else {
+					r.succeeded(t)
+				}
+
+				if !finished {
+					for _, t := range tasks[i+1:] {
+						r.skipped(t, "still busy from an earlier task")
+					}
+					return
+				}
+			}
+
+			p.unlock(key)
+		}(key, byKey[key])
+	}
+
+	wg.Wait()
+}
+
+// exec runs a single task, returning whether it finished. On timeout the
+// service stays locked until it really finishes, but its slot is freed for
+// other tasks.
+func (p *pool) exec(t task) (bool, error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- t.fn()
+	}()
+
+	select {
+	case err := <-done:
+		return true, err
+	case <-time.After(p.timeout):
+		go func() {
+			<-done
+			p.unlock(t.key())
+		}()
+		return false, fmt.Errorf("Timed out after %v", p.timeout)
+	}
+}
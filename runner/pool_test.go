@@ -0,0 +1,192 @@
+package runner
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolConcurrency(t *testing.T) {
+	p := newPool(2, time.Second)
+
+	var running, maxRunning int32
+	var tasks []task
+	for i := 0; i < 6; i++ {
+		tasks = append(tasks, task{
+			action:  actionStart,
+			name:    "com.HailoOSS.service.foo",
+			version: uint64(i),
+			fn: func() error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			},
+		})
+	}
+
+	r := newReport()
+	p.run(tasks, r)
+
+	if maxRunning != 2 {
+		t.Errorf("Expected 2 tasks to run at once, got %d", maxRunning)
+	}
+
+	if r.Count(resultStarted) != 6 {
+		t.Errorf("Expected 6 started services in report, got %d", r.Count(resultStarted))
+	}
+}
+
+func TestPoolTimeout(t *testing.T) {
+	p := newPool(1, time.Millisecond)
+
+	// the slow task blocks until released, so it always times out
+	release := make(chan struct{})
+	slow := task{
+		action:  actionStop,
+		name:    "com.HailoOSS.service.foo",
+		version: 1,
+		fn: func() error {
+			<-release
+			return nil
+		},
+	}
+
+	r := newReport()
+	p.run([]task{slow}, r)
+	if r.Count(resultFailed) != 1 {
+		t.Error("Expected the slow task to time out")
+	}
+
+	// other tasks mustn't time out, however slowly they run
+	p.timeout = time.Hour
+
+	// the slow task still holds its service, but not its slot
+	var ran []uint64
+	record := func(version uint64) task {
+		return task{
+			action:  actionStart,
+			name:    "com.HailoOSS.service.foo",
+			version: version,
+			fn: func() error {
+				ran = append(ran, version)
+				return nil
+			},
+		}
+	}
+
+	r = newReport()
+	p.run([]task{record(1), record(2)}, r)
+
+	if len(ran) != 1 || ran[0] != 2 {
+		t.Errorf("Expected only version 2 to run while version 1 is busy, got %v", ran)
+	}
+
+	if r.Count(resultSkipped) != 1 || r.Count(resultStarted) != 1 {
+		t.Errorf("Expected one skipped and one started service in report, got %v", r.Actions)
+	}
+
+	// wait for the slow task to finish and release its service
+	close(release)
+	for !p.lock(slow.key()) {
+		runtime.Gosched()
+	}
+	p.unlock(slow.key())
+
+	p.run([]task{record(1)}, newReport())
+
+	if len(ran) != 2 {
+		t.Errorf("Expected version 1 to run once it finished, got %v", ran)
+	}
+}
+
+func TestPoolErrors(t *testing.T) {
+	p := newPool(2, time.Second)
+
+	r := newReport()
+	p.run([]task{
+		{action: actionStart, name: "com.HailoOSS.service.foo", version: 1, fn: func() error { return fmt.Errorf("broken") }},
+		{action: actionStop, name: "com.HailoOSS.service.bar", version: 1, fn: func() error { return nil }},
+	}, r)
+
+	if r.Count(resultFailed) != 1 || r.Count(resultStopped) != 1 {
+		t.Errorf("Expected one failed and one stopped service in report, got %v", r.Actions)
+	}
+
+	for _, a := range r.Actions {
+		if a.Result == resultFailed && a.Reason != "broken" {
+			t.Errorf("Expected failure reason to be recorded, got %q", a.Reason)
+		}
+	}
+}
+
+func TestPoolInstances(t *testing.T) {
+	p := newPool(2, time.Second)
+
+	var ran int32
+	instance := func(i int) task {
+		return task{
+			action:   actionStop,
+			name:     "com.HailoOSS.service.foo",
+			version:  1,
+			instance: i,
+			fn: func() error {
+				atomic.AddInt32(&ran, 1)
+				return nil
+			},
+		}
+	}
+
+	r := newReport()
+	p.run([]task{instance(1), instance(2)}, r)
+
+	if ran != 2 {
+		t.Errorf("Expected instances of the same service to be stopped one after another, got %d stopped", ran)
+	}
+
+	for _, a := range r.Actions {
+		if a.Instance != 1 && a.Instance != 2 {
+			t.Errorf("Expected instance to be recorded in report, got %d", a.Instance)
+		}
+	}
+}
+
+func TestPoolServiceLock(t *testing.T) {
+	p := newPool(2, time.Second)
+
+	var running, overlapped int32
+	act := func(action string, instance int) task {
+		return task{
+			action:   action,
+			name:     "com.HailoOSS.service.foo",
+			version:  1,
+			instance: instance,
+			fn: func() error {
+				if atomic.AddInt32(&running, 1) > 1 {
+					atomic.StoreInt32(&overlapped, 1)
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			},
+		}
+	}
+
+	r := newReport()
+	p.run([]task{act(actionStart, 0), act(actionStop, 2)}, r)
+
+	if overlapped != 0 {
+		t.Error("Expected a start and a scale down of the same service not to run at once")
+	}
+	if r.Count(resultStarted) != 1 || r.Count(resultStopped) != 1 {
+		t.Errorf("Expected both tasks to run, got %v", r.Actions)
+	}
+}
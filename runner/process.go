@@ -2,26 +2,36 @@ package runner
 
 import (
 	"fmt"
+	"time"
 
 	log "github.com/cihub/seelog"
 
-	"github.com/HailoOSS/go-hailo-lib/multierror"
 	"github.com/HailoOSS/provisioning-service/dao"
 	"github.com/HailoOSS/provisioning-service/deps"
 	"github.com/HailoOSS/provisioning-service/event"
+	"github.com/HailoOSS/provisioning-service/health"
 	"github.com/HailoOSS/provisioning-service/pkgmgr"
 	"github.com/HailoOSS/provisioning-service/process"
 )
 
-func startMissingProcesses(provisionedServices dao.ProvisionedServices) error {
-	me := multierror.New()
-
+func startMissingProcesses(provisionedServices dao.ProvisionedServices, r *Report) error {
 	// start up any services that aren't running but should be
 	runningProcesses, err := process.ListRunning("com.HailoOSS")
 	if err != nil {
 		return err
 	}
 
+	p := newPlanner(true, nil)
+	p.ordered(provisionedServices.OfType(dao.ServiceTypeProcess))
+	p.processStarts(provisionedServices, runningProcesses)
+	p.run(r)
+
+	process.EnforceLimits()
+	return nil
+}
+
+// processStarts plans starting provisioned processes which aren't running
+func (p *planner) processStarts(provisionedServices dao.ProvisionedServices, runningProcesses []string) {
 	for _, service := range provisionedServices {
 		if service.ServiceType != dao.ServiceTypeProcess {
 			continue
@@ -29,103 +39,257 @@ func startMissingProcesses(provisionedServices dao.ProvisionedServices) error {
 
 		numInstances := process.CachedCountRunningInstances(service.ServiceName, service.ServiceVersion, runningProcesses)
 
-		if numInstances > 0 {
+		if numInstances > 0 && p.live {
+			// limits may have changed, or not be known since we restarted
+			if err := process.SetLimits(service.ServiceName, service.ServiceVersion, service.CPU, service.Memory); err != nil {
+				log.Warnf("Failed to set limits of service %v: %v", service, err)
+			}
+		}
+
+		if numInstances >= service.DesiredInstances() {
+			if p.live && crashes.running(service.ServiceName, service.ServiceVersion) {
+				knownGood.record(service.ServiceName, service.ServiceVersion, service.ServiceType)
+			}
 			continue
 		}
 
-		// Load the service dependencies
-		if err := deps.Load(service.ServiceName); err != nil {
-			log.Criticalf("Failed to load dependencies for service %s: %v", service.ServiceName, err)
-		}
-
-		log.Debugf("Service %v is not yet running", service)
-		if dl, _ := pkgmgr.IsDownloaded(service); !dl {
-			log.Debugf("Service %v is not yet downloaded", service)
-			_, err := pkgmgr.Download(service)
-			if err != nil {
-				// log error and continue, so we don't block other provisioned services
-				msg := fmt.Sprintf("Provisioned service could not be downloaded: %v", err)
-				log.Warnf(msg)
-				event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
-				me.Add(err)
-				// Delete downloaded file if it exists
-				if err := pkgmgr.Delete(service); err != nil {
-					log.Warnf("Failed deleting file after failing to download: %v", err)
-				}
+		service := service
+		t := task{
+			action:  actionStart,
+			name:    service.ServiceName,
+			version: service.ServiceVersion,
+			typ:     dao.ServiceTypeProcess,
+			steps:   processStartSteps(service),
+			fn: func() error {
+				err := startProcess(service)
+				crashes.started(service.ServiceName, service.ServiceVersion, err)
+				return err
+			},
+		}
+
+		if ok, retryAt := p.shouldStart(service.ServiceName, service.ServiceVersion); !ok {
+			p.skip(t, fmt.Sprintf("Backing off after failures until %v", retryAt.Format(time.RFC3339)))
+			if numInstances > 0 {
+				// some instances are up, so this version is not all bad
 				continue
 			}
-			log.Debugf("Downloaded service: %v!", service)
+			if rt, ok := p.rollbackTask(service, func(ps *dao.ProvisionedService) bool {
+				return process.CachedCountRunningInstances(ps.ServiceName, ps.ServiceVersion, runningProcesses) > 0
+			}, startProcess); ok {
+				rt.steps = processStartSteps(&dao.ProvisionedService{ServiceName: rt.name, ServiceVersion: rt.version})
+				p.add(rt)
+			}
+			continue
 		}
 
-		// Verify the binary, if it fails, delete and wait for the next cycle
-		if err := pkgmgr.VerifyBinary(service); err != nil {
-			msg := fmt.Sprintf("Failed to verify binary, will be deleted, err: %v", err)
-			log.Criticalf(msg)
+		p.add(t)
+	}
+}
+
+// processStartSteps describes starting a process
+func processStartSteps(service *dao.ProvisionedService) []string {
+	var steps []string
+	if dl, _ := pkgmgr.IsDownloaded(service); !dl {
+		steps = append(steps, stepDownload)
+	}
+	return append(steps, stepVerify, stepStart)
+}
+
+func startProcess(service *dao.ProvisionedService) error {
+	// Load the service dependencies
+	if err := deps.Load(service.ServiceName); err != nil {
+		log.Criticalf("Failed to load dependencies for service %s: %v", service.ServiceName, err)
+	}
+
+	log.Debugf("Service %v is not yet running", service)
+	if dl, _ := pkgmgr.IsDownloaded(service); !dl {
+		log.Debugf("Service %v is not yet downloaded", service)
+		_, err := pkgmgr.Download(service)
+		if err != nil {
+			// log error and continue, so we don't block other provisioned services
+			msg := fmt.Sprintf("Provisioned service could not be downloaded: %v", err)
+			log.Warnf(msg)
 			event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
+			// Delete downloaded file if it exists
 			if err := pkgmgr.Delete(service); err != nil {
-				log.Warnf("Failed to delete binary: %v", err)
+				log.Warnf("Failed deleting file after failing to download: %v", err)
 			}
-			continue
+			return err
 		}
+		log.Debugf("Downloaded service: %v!", service)
+	}
 
-		if err := process.Start(service.ServiceName, service.ServiceVersion, service.NoFileSoftLimit, service.NoFileHardLimit); err != nil {
-			msg := fmt.Sprintf("Provisioned service could not be started: %v", err)
-			log.Warnf(msg)
-			event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
-			me.Add(err)
+	// Verify the binary, if it fails, delete and wait for the next cycle
+	if err := pkgmgr.VerifyBinary(service); err != nil {
+		msg := fmt.Sprintf("Failed to verify binary, will be deleted, err: %v", err)
+		log.Criticalf(msg)
+		event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
+		if err := pkgmgr.Delete(service); err != nil {
+			log.Warnf("Failed to delete binary: %v", err)
+		}
+		return err
+	}
+
+	process.SetEnvironment(service.ServiceName, service.ServiceVersion, service.Env, service.Args)
+
+	// run without limits rather than not at all, e.g. on hosts without cgroup v2
+	if err := process.SetLimits(service.ServiceName, service.ServiceVersion, service.CPU, service.Memory); err != nil {
+		log.Warnf("Failed to set limits of service %v: %v", service, err)
+	}
+
+	running, err := process.RunningInstances(service.ServiceName, service.ServiceVersion)
+	if err != nil {
+		return err
+	}
+
+	isRunning := make(map[int]bool, len(running))
+	for _, instance := range running {
+		isRunning[instance] = true
+	}
+
+	for instance := 0; instance < service.DesiredInstances(); instance++ {
+		if isRunning[instance] {
 			continue
 		}
+		if err := startInstance(service, instance); err != nil {
+			return err
+		}
+	}
 
-		log.Debugf("Started service %v!", service)
-		event.Provisioned(service.ServiceName, service.ServiceVersion)
+	log.Debugf("Started service %v!", service)
+	event.Provisioned(service.ServiceName, service.ServiceVersion)
+	return nil
+}
+
+// startInstance starts a single instance of a service and waits for it to
+// become ready
+func startInstance(service *dao.ProvisionedService, instance int) error {
+	if err := process.Start(service.ServiceName, service.ServiceVersion, instance, service.NoFileSoftLimit, service.NoFileHardLimit); err != nil {
+		msg := fmt.Sprintf("Provisioned service could not be started: %v", err)
+		log.Warnf(msg)
+		event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
+		return err
 	}
 
-	if me.AnyErrors() {
-		return me
+	if err := health.WaitReady(service, func() bool {
+		running, err := process.RunningInstances(service.ServiceName, service.ServiceVersion)
+		if err != nil {
+			return false
+		}
+		for _, i := range running {
+			if i == instance {
+				return true
+			}
+		}
+		return false
+	}); err != nil {
+		msg := fmt.Sprintf("Provisioned service instance %d did not become ready: %v", instance, err)
+		log.Warnf(msg)
+		event.ProvisionError(service.ServiceName, service.ServiceVersion, msg)
+		// stop it so it is retried, rather than left running unready
+		if err := process.Stop(service.ServiceName, service.ServiceVersion, instance); err != nil {
+			log.Warnf("Failed to stop instance %d of service %v after it did not become ready: %v", instance, service, err)
+		}
+		return err
 	}
 
 	return nil
 }
 
-func stopExtraProcesses(provisionedServices dao.ProvisionedServices) error {
+func stopExtraProcesses(provisionedServices, suspendedServices dao.ProvisionedServices, r *Report) error {
 	// stop any services that are running but shouldn't be
 	runningProcessNames, err := process.ListRunning("com.HailoOSS")
 	if err != nil {
 		return err
 	}
 
-	me := multierror.New()
+	p := newPlanner(true, suspendedServices)
+	// stop dependents first; cycles were reported when starting
+	p.order = newServiceOrder(provisionedServices.OfType(dao.ServiceTypeProcess))
+	p.processStops(provisionedServices, runningProcessNames)
+	p.run(r)
+	return nil
+}
 
+// processStops plans stopping running processes which aren't provisioned
+func (p *planner) processStops(provisionedServices dao.ProvisionedServices, runningProcessNames []string) {
+	running := make(map[string]bool)
 	for _, runningProcessName := range runningProcessNames {
-		runningName, runningVersion, err := splitProcessName(runningProcessName)
+		runningName, runningVersion, runningInstance, err := splitInstanceName(runningProcessName)
 		if err != nil {
-			me.Add(err)
+			p.error(err)
 			continue
 		}
+		running[combineNameVersion(runningName, runningVersion)] = true
 
-		if provisionedServices.Contains(runningName, runningVersion, dao.ServiceTypeProcess) {
+		if service := provisionedServices.Find(runningName, runningVersion, dao.ServiceTypeProcess); service != nil {
+			if runningInstance < service.DesiredInstances() {
+				continue
+			}
+
+			// the service has been scaled down
+			p.add(task{
+				action:   actionStop,
+				name:     runningName,
+				version:  runningVersion,
+				instance: runningInstance,
+				typ:      dao.ServiceTypeProcess,
+				steps:    []string{stepStop},
+				fn: func() error {
+					return process.Stop(runningName, runningVersion, runningInstance)
+				},
+			})
 			continue
 		}
 
-		if err := process.Stop(runningName, runningVersion); err != nil {
-			event.DeprovisionError(runningName, runningVersion, err.Error())
-			me.Add(err)
+		t := task{
+			action:   actionStop,
+			name:     runningName,
+			version:  runningVersion,
+			instance: runningInstance,
+			typ:      dao.ServiceTypeProcess,
+			steps:    []string{stepStop},
+			fn: func() error {
+				return stopProcess(runningName, runningVersion, runningInstance)
+			},
+		}
+
+		if p.suspended.Contains(runningName, runningVersion, dao.ServiceTypeProcess) {
+			p.suspend(t)
 			continue
 		}
 
-		if err := pkgmgr.Delete(&dao.ProvisionedService{
-			ServiceName:    runningName,
-			ServiceVersion: runningVersion,
-		}); err != nil {
-			me.Add(err)
+		if p.holdUpgrade(t, provisionedServices, func(ps *dao.ProvisionedService) bool {
+			return process.CachedCountRunningInstances(ps.ServiceName, ps.ServiceVersion, runningProcessNames) >= ps.DesiredInstances()
+		}) {
+			continue
 		}
 
-		event.Deprovisioned(runningName, runningVersion)
+		if provisionedServices.Replacement(runningName, runningVersion, dao.ServiceTypeProcess) == nil {
+			p.deprovision(t)
+			continue
+		}
+
+		p.add(t)
+	}
+
+	p.addSuspensions()
+	p.addDeprovisions(dao.ServiceTypeProcess, len(running))
+}
+
+// stopProcess stops an instance of a service, leaving its binary for the
+// janitor so that recent versions can be rolled back to
+func stopProcess(runningName string, runningVersion uint64, runningInstance int) error {
+	if err := process.Stop(runningName, runningVersion, runningInstance); err != nil {
+		event.DeprovisionError(runningName, runningVersion, err.Error())
+		return err
 	}
 
-	if me.AnyErrors() {
-		return me
+	if n, err := process.CountRunningInstances(runningName, runningVersion); err != nil || n > 0 {
+		return nil
 	}
 
+	crashes.forget(runningName, runningVersion)
+	event.Deprovisioned(runningName, runningVersion)
 	return nil
 }
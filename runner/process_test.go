@@ -42,7 +42,7 @@ func TestStopExtraProcesses(t *testing.T) {
 
 	extraP := &dao.ProvisionedService{ServiceName: "com.HailoOSS.service.provisioning.teststopextra", ServiceVersion: 20130102030405, MachineClass: "A"}
 
-	if err := proc.Start("com.HailoOSS.service.provisioning.teststopextra", 20130102030405, 1024, 4096); err != nil {
+	if err := proc.Start("com.HailoOSS.service.provisioning.teststopextra", 20130102030405, 0, 1024, 4096); err != nil {
 		t.Error("Error starting service:", err)
 	}
 
@@ -55,9 +55,13 @@ func TestStopExtraProcesses(t *testing.T) {
 	}
 
 	pss := make(dao.ProvisionedServices, 0)
-	if err := stopExtraProcesses(pss); err != nil {
+	r := newReport()
+	if err := stopExtraProcesses(pss, nil, r); err != nil {
 		t.Error("Error testing StopExtraProcesses(): ", err)
 	}
+	if r.Count(resultStopped) != 1 {
+		t.Error("Error testing StopExtraProcesses() - expected one stopped service in report: ", r.Actions)
+	}
 
 	numInstances, err = proc.CountRunningInstances(extraP.ServiceName, extraP.ServiceVersion)
 	if err != nil {
@@ -0,0 +1,151 @@
+package runner
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/maintenance"
+	"github.com/HailoOSS/provisioning-service/process"
+)
+
+const (
+	actionStart    = "start"
+	actionStop     = "stop"
+	actionRollback = "rollback"
+	actionClean    = "clean"
+
+	resultStarted = "started"
+	resultStopped = "stopped"
+	resultFailed  = "failed"
+	resultSkipped = "skipped"
+)
+
+var (
+	reportMtx  sync.RWMutex
+	lastReport *Report
+)
+
+// Action is the outcome of acting on a single service during a check
+type Action struct {
+	ServiceName    string
+	ServiceVersion uint64
+	Instance       int
+	ServiceType    dao.ServiceType
+	Action         string
+	Result         string
+	Reason         string
+}
+
+// Report describes everything done in a single check
+type Report struct {
+	Started  time.Time
+	Finished time.Time
+	Actions  []*Action
+	Errors   []string
+
+	// maintenance pauses acting on some or all services
+	maintenance *maintenance.State
+
+	mtx sync.Mutex
+}
+
+func newReport() *Report {
+	return &Report{
+		Started: time.Now(),
+	}
+}
+
+func (r *Report) add(t task, result, reason string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.Actions = append(r.Actions, &Action{
+		ServiceName:    t.name,
+		ServiceVersion: t.version,
+		Instance:       t.instance,
+		ServiceType:    t.typ,
+		Action:         t.action,
+		Result:         result,
+		Reason:         reason,
+	})
+}
+
+// succeeded records a task which did what it set out to do
+func (r *Report) succeeded(t task) {
+	result := resultStarted
+	if t.action == actionStop {
+		result = resultStopped
+	}
+
+	r.add(t, result, "")
+}
+
+func (r *Report) failed(t task, err error) {
+	r.add(t, resultFailed, err.Error())
+}
+
+func (r *Report) skipped(t task, reason string) {
+	r.add(t, resultSkipped, reason)
+}
+
+// error records an error which stopped part of a check running at all
+func (r *Report) error(err error) {
+	r.mtx.Lock()
+	r.Errors = append(r.Errors, err.Error())
+	r.mtx.Unlock()
+}
+
+// Count returns the number of actions with a result
+func (r *Report) Count(result string) int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var n int
+	for _, a := range r.Actions {
+		if a.Result == result {
+			n++
+		}
+	}
+	return n
+}
+
+// finish logs the report and makes it available as the last report
+func (r *Report) finish() {
+	r.mtx.Lock()
+	r.Finished = time.Now()
+
+	for _, a := range r.Actions {
+		if a.Result == resultFailed {
+			log.Warnf("Failed to %s %s: %s", a.Action, process.InstanceName(a.ServiceName, a.ServiceVersion, a.Instance), a.Reason)
+		}
+	}
+
+	for _, err := range r.Errors {
+		log.Warnf("Error checking services: %s", err)
+	}
+	r.mtx.Unlock()
+
+	summary := fmt.Sprintf("Check finished in %v: %d started, %d stopped, %d failed, %d skipped, %d errors",
+		r.Finished.Sub(r.Started), r.Count(resultStarted), r.Count(resultStopped), r.Count(resultFailed), r.Count(resultSkipped), len(r.Errors))
+	if len(r.Actions) > 0 || len(r.Errors) > 0 {
+		log.Info(summary)
+	} else {
+		log.Debug(summary)
+	}
+
+	reportMtx.Lock()
+	lastReport = r
+	reportMtx.Unlock()
+}
+
+// LastReport returns the report from the last completed check
+func LastReport() *Report {
+	reportMtx.RLock()
+	defer reportMtx.RUnlock()
+
+	return lastReport
+}
@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/event"
+	"github.com/HailoOSS/provisioning-service/fsutil"
+)
+
+const (
+	defaultKnownGoodFile = "/opt/hailo/var/cache/known-good.json"
+)
+
+var (
+	// rollbackEnabled reinstates the last known-good version of services
+	// whose provisioned version fails to start
+	rollbackEnabled = os.Getenv("H2O_ROLLBACK") == "true"
+	knownGood       = newKnownGoodStore(defaultKnownGoodFile)
+)
+
+// knownGoodStore records, per service, the last version which stayed up
+type knownGoodStore struct {
+	path string
+
+	mtx      sync.Mutex
+	loaded   bool
+	versions map[string]uint64
+}
+
+func newKnownGoodStore(path string) *knownGoodStore {
+	return &knownGoodStore{
+		path:     path,
+		versions: make(map[string]uint64),
+	}
+}
+
+func knownGoodKey(name string, typ dao.ServiceType) string {
+	return fmt.Sprintf("%s:%d", name, typ)
+}
+
+func (k *knownGoodStore) load() {
+	if k.loaded {
+		return
+	}
+	k.loaded = true
+
+	b, err := ioutil.ReadFile(k.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed to read known-good versions: %v", err)
+		}
+		return
+	}
+
+	if err := json.Unmarshal(b, &k.versions); err != nil {
+		log.Warnf("Failed to parse known-good versions: %v", err)
+	}
+}
+
+func (k *knownGoodStore) save() error {
+	b, err := json.Marshal(k.versions)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFile(k.path, b, 0644)
+}
+
+// record marks a version of a service as known-good
+func (k *knownGoodStore) record(name string, version uint64, typ dao.ServiceType) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	k.load()
+
+	key := knownGoodKey(name, typ)
+	if k.versions[key] == version {
+		return
+	}
+
+	k.versions[key] = version
+	if err := k.save(); err != nil {
+		log.Warnf("Failed to save known-good version of %s: %v", name, err)
+	}
+}
+
+// get returns the last known-good version of a service
+func (k *knownGoodStore) get(name string, typ dao.ServiceType) (uint64, bool) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	k.load()
+
+	version, ok := k.versions[knownGoodKey(name, typ)]
+	return version, ok
+}
+
+// builds returns the names of all known-good builds
+func (k *knownGoodStore) builds() []string {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	k.load()
+
+	var builds []string
+	for key, version := range k.versions {
+		name := key[:strings.LastIndex(key, ":")]
+		builds = append(builds, combineNameVersion(name, version))
+	}
+	return builds
+}
+
+// rollbackTask returns a task which starts the last known-good version of a
+// service whose provisioned version is failing, if rollback is enabled and
+// that version isn't already running
+func (p *planner) rollbackTask(service *dao.ProvisionedService, isRunning func(*dao.ProvisionedService) bool, start func(*dao.ProvisionedService) error) (task, bool) {
+	if !rollbackEnabled {
+		return task{}, false
+	}
+
+	version, ok := knownGood.get(service.ServiceName, service.ServiceType)
+	if !ok || version == service.ServiceVersion {
+		return task{}, false
+	}
+
+	good := *service
+	good.ServiceVersion = version
+	if isRunning(&good) {
+		return task{}, false
+	}
+
+	// the known-good version may have started failing too
+	if ok, _ := p.shouldStart(good.ServiceName, good.ServiceVersion); !ok {
+		return task{}, false
+	}
+
+	return task{
+		action:  actionRollback,
+		name:    good.ServiceName,
+		version: good.ServiceVersion,
+		typ:     good.ServiceType,
+		fn: func() error {
+			err := start(&good)
+			crashes.started(good.ServiceName, good.ServiceVersion, err)
+			if err != nil {
+				return err
+			}
+
+			info := fmt.Sprintf("Version %d failed to start, rolled back to %d", service.ServiceVersion, good.ServiceVersion)
+			log.Warnf("Service %s: %s", service.ServiceName, info)
+			event.RolledBack(good.ServiceName, good.ServiceVersion, info)
+			return nil
+		},
+	}, true
+}
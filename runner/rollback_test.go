@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+func TestKnownGoodStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knowngood")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cache", "known-good.json")
+	k := newKnownGoodStore(path)
+	if _, ok := k.get("com.HailoOSS.service.foo", dao.ServiceTypeProcess); ok {
+		t.Error("Expected no known-good version before one is recorded")
+	}
+
+	k.record("com.HailoOSS.service.foo", 1, dao.ServiceTypeProcess)
+	k.record("com.HailoOSS.service.foo", 2, dao.ServiceTypeProcess)
+
+	// versions survive a restart
+	k = newKnownGoodStore(path)
+	if v, ok := k.get("com.HailoOSS.service.foo", dao.ServiceTypeProcess); !ok || v != 2 {
+		t.Errorf("Expected known-good version 2, got %v %v", v, ok)
+	}
+	if _, ok := k.get("com.HailoOSS.service.foo", dao.ServiceTypeContainer); ok {
+		t.Error("Expected known-good versions to be tracked per service type")
+	}
+}
+
+func TestRollbackTask(t *testing.T) {
+	published, restore := stubEvents()
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "knowngood")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(enabled bool, k *knownGoodStore) {
+		rollbackEnabled, knownGood = enabled, k
+	}(rollbackEnabled, knownGood)
+	knownGood = newKnownGoodStore(filepath.Join(dir, "known-good.json"))
+
+	service := &dao.ProvisionedService{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 2}
+	notRunning := func(*dao.ProvisionedService) bool { return false }
+	var started []uint64
+	start := func(ps *dao.ProvisionedService) error {
+		started = append(started, ps.ServiceVersion)
+		return nil
+	}
+
+	knownGood.record("com.HailoOSS.service.foo", 1, dao.ServiceTypeProcess)
+	p := newPlanner(true, nil)
+
+	rollbackEnabled = false
+	if _, ok := p.rollbackTask(service, notRunning, start); ok {
+		t.Error("Expected no rollback unless enabled")
+	}
+
+	rollbackEnabled = true
+	if _, ok := p.rollbackTask(service, func(*dao.ProvisionedService) bool { return true }, start); ok {
+		t.Error("Expected no rollback while the known-good version is running")
+	}
+
+	rt, ok := p.rollbackTask(service, notRunning, start)
+	if !ok {
+		t.Fatal("Expected to roll back to the known-good version")
+	}
+	defer crashes.forget("com.HailoOSS.service.foo", 1)
+
+	if rt.action != actionRollback || rt.version != 1 {
+		t.Errorf("Expected a rollback to version 1, got %s %d", rt.action, rt.version)
+	}
+	if err := rt.fn(); err != nil || len(started) != 1 || started[0] != 1 {
+		t.Errorf("Expected version 1 to be started, got %v %v", started, err)
+	}
+	if len(*published) != 1 || (*published)[0] != "ROLLED BACK com.HailoOSS.service.foo-1" {
+		t.Errorf("Expected the rollback to be published, got %v", *published)
+	}
+
+	knownGood.record("com.HailoOSS.service.foo", 2, dao.ServiceTypeProcess)
+	if _, ok := p.rollbackTask(service, notRunning, func(*dao.ProvisionedService) error { return fmt.Errorf("unused") }); ok {
+		t.Error("Expected no rollback when the failing version is the known-good one")
+	}
+}
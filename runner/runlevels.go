@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/HailoOSS/platform/util"
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/event"
+)
+
+const (
+	// how many services to stop in a check when the run level drops
+	defaultRunLevelStops = 2
+)
+
+var (
+	levels = newRunLevelTracker()
+)
+
+// runLevelTracker keeps the run level of our region, and the minimum run
+// levels of provisioned services. Services whose minimum is above the
+// region's level are suspended: they are stopped a few at a time, least
+// essential first, and started again once the level is raised.
+type runLevelTracker struct {
+	region   string
+	maxStops int
+
+	mtx      sync.Mutex
+	loaded   bool
+	known    bool
+	level    int64
+	services map[string]int64
+}
+
+func newRunLevelTracker() *runLevelTracker {
+	region := os.Getenv("H2O_REGION")
+	if len(region) == 0 {
+		// availability zones are the region with a letter on the end
+		if az, err := util.GetAwsAZName(); err == nil && len(az) > 1 {
+			region = az[:len(az)-1]
+		}
+	}
+
+	stops, err := strconv.Atoi(os.Getenv("H2O_RUNLEVEL_STOPS"))
+	if err != nil || stops < 1 {
+		stops = defaultRunLevelStops
+	}
+
+	return &runLevelTracker{
+		region:   region,
+		maxStops: stops,
+		services: make(map[string]int64),
+	}
+}
+
+// refresh reads the run level of our region, and keeps the minimum run
+// levels of services. Both come from config we already hold, so this doesn't
+// block a check.
+func (l *runLevelTracker) refresh(services dao.ProvisionedServices) {
+	level, known := dao.RunLevel(l.region)
+
+	serviceLevels := make(map[string]int64, len(services))
+	for _, service := range services {
+		serviceLevels[service.ServiceName] = service.RunLevel
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.loaded && (known != l.known || level != l.level) {
+		info := fmt.Sprintf("Run level of region %s changed from %s to %s", l.region, describeLevel(l.level, l.known), describeLevel(level, known))
+		log.Warn(info)
+		event.RunLevelChanged(info)
+	} else if !l.loaded && known {
+		log.Infof("Run level of region %s is %d", l.region, level)
+	}
+
+	l.loaded = true
+	l.known = known
+	l.level = level
+	l.services = serviceLevels
+}
+
+func describeLevel(level int64, known bool) string {
+	if !known {
+		return "unset"
+	}
+	return strconv.FormatInt(level, 10)
+}
+
+// apply splits services into those which should run at the current run
+// level, and those which are suspended
+func (l *runLevelTracker) apply(services dao.ProvisionedServices) (dao.ProvisionedServices, dao.ProvisionedServices) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if !l.known {
+		return services, nil
+	}
+
+	var running, suspended dao.ProvisionedServices
+	for _, service := range services {
+		if service.RunLevel > l.level {
+			suspended = append(suspended, service)
+		} else {
+			running = append(running, service)
+		}
+	}
+	return running, suspended
+}
+
+// of returns the minimum run level of a service
+func (l *runLevelTracker) of(name string) int64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return l.services[name]
+}
+
+// suspend plans stopping a service suspended by the run level
+func (p *planner) suspend(t task) {
+	p.suspensions = append(p.suspensions, t)
+}
+
+// addSuspensions adds the planned stops of suspended services, least
+// essential first, only stopping a few in each check
+func (p *planner) addSuspensions() {
+	sort.Stable(byRunLevel(p.suspensions))
+
+	for i, t := range p.suspensions {
+		if i < levels.maxStops {
+			p.add(t)
+		} else {
+			p.skip(t, "waiting to stop for run level")
+		}
+	}
+	p.suspensions = nil
+}
+
+// byRunLevel sorts tasks by the minimum run level of their service, highest
+// first
+type byRunLevel []task
+
+func (t byRunLevel) Len() int           { return len(t) }
+func (t byRunLevel) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byRunLevel) Less(i, j int) bool { return levels.of(t[i].name) > levels.of(t[j].name) }
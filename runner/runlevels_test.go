@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+func TestRunLevels(t *testing.T) {
+	defer func(l *runLevelTracker) { levels = l }(levels)
+	levels = newRunLevelTracker()
+	levels.maxStops = 1
+
+	services := dao.ProvisionedServices{
+		{ServiceName: "com.HailoOSS.service.essential", ServiceVersion: 1},
+		{ServiceName: "com.HailoOSS.service.useful", ServiceVersion: 1, RunLevel: 2},
+		{ServiceName: "com.HailoOSS.service.luxury", ServiceVersion: 1, RunLevel: 3},
+	}
+
+	levels.refresh(services)
+	if running, suspended := levels.apply(services); len(running) != 3 || len(suspended) != 0 {
+		t.Errorf("Expected every service to run without a run level, got %d running", len(running))
+	}
+
+	levels.known = true
+	levels.level = 1
+
+	running, suspended := levels.apply(services)
+	if len(running) != 1 || running[0].ServiceName != "com.HailoOSS.service.essential" || len(suspended) != 2 {
+		t.Fatalf("Expected only the essential service to run at level 1, got %d running", len(running))
+	}
+
+	p := newPlanner(false, suspended)
+	p.processStops(running, []string{
+		"/etc/init/com.HailoOSS.service.essential-1@0",
+		"/etc/init/com.HailoOSS.service.useful-1@0",
+		"/etc/init/com.HailoOSS.service.luxury-1@0",
+	})
+
+	if len(p.tasks) != 2 {
+		t.Fatalf("Expected both suspended services to be planned, got %d tasks", len(p.tasks))
+	}
+	if p.tasks[0].name != "com.HailoOSS.service.luxury" || p.tasks[0].skip != "" {
+		t.Errorf("Expected the least essential service to be stopped first, got %s %q", p.tasks[0].name, p.tasks[0].skip)
+	}
+	if p.tasks[1].skip == "" {
+		t.Error("Expected only one service to be stopped in a check")
+	}
+}
@@ -1,25 +1,35 @@
 package runner
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/cihub/seelog"
+	"github.com/HailoOSS/service/config"
 	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/maintenance"
+	"github.com/HailoOSS/provisioning-service/process"
 )
 
 const (
-	checkInterval = 5
+	defaultConcurrency = 4
+	defaultTimeout     = 10 * time.Minute
+	defaultMaxCacheAge = 24 * time.Hour
 )
 
 var (
 	myClass string
 	docker  bool
+	workers *pool
+
+	dryRunMode = flag.Bool("dry-run", false, "Log what would be started and stopped, without doing it")
 )
 
 func init() {
@@ -27,9 +37,25 @@ func init() {
 	if len(myClass) == 0 {
 		myClass = "default"
 	}
+
+	concurrency, err := strconv.Atoi(os.Getenv("H2O_RUNNER_CONCURRENCY"))
+	if err != nil {
+		concurrency = defaultConcurrency
+	}
+
+	timeout, err := time.ParseDuration(os.Getenv("H2O_RUNNER_TIMEOUT"))
+	if err != nil {
+		timeout = defaultTimeout
+	}
+
+	workers = newPool(concurrency, timeout)
 }
 
 func Run() {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
 	go run()
 }
 
@@ -41,7 +67,15 @@ func run() {
 
 	docker = isDockerized()
 
-	if docker {
+	if *dryRunMode {
+		log.Info("Dry run, nothing will be started or stopped")
+	}
+
+	if !*dryRunMode {
+		go watch()
+	}
+
+	if docker && !*dryRunMode {
 		j := &janitor{
 			maxStoppedTime: 60 * time.Minute,
 			sleepInterval:  30 * time.Second,
@@ -49,50 +83,125 @@ func run() {
 		go j.clean()
 	}
 
-	ticker := time.NewTicker(checkInterval * time.Second)
+	// check straight away, then whenever provisions change, polling slowly
+	// in case a change is missed
 	for {
-		select {
-		case <-ticker.C:
+		if *dryRunMode {
+			dryRun()
+		} else {
 			check()
 		}
+
+		poll := time.NewTimer(jitter(pollInterval()))
+		select {
+		case <-poll.C:
+		case reason := <-triggers:
+			poll.Stop()
+			debounce(reason)
+		}
 	}
 }
 
 func check() {
 	log.Debug("Checking running services ...")
 
-	services, err := dao.Services(myClass)
-	if err != nil {
-		log.Warn("Error fetching provisioned services list: ", err)
+	r := newReport()
+	defer r.finish()
+
+	r.maintenance = maintenance.Check()
+	if r.maintenance != nil && r.maintenance.All() {
+		log.Debugf("Not checking services during maintenance of %v", r.maintenance)
 		return
 	}
 
-	log.Debugf("Found %d services that should be running", len(services))
-
-	// Loop through our processes
-	if err := startMissingProcesses(services); err != nil {
-		log.Warnf("Error starting missing services: %v ", err)
+	services, err := dao.Services(myClass)
+	if err != nil {
+		r.error(fmt.Errorf("Error fetching provisioned services list: %v", err))
 		return
 	}
 
-	if err := stopExtraProcesses(services); err != nil {
-		log.Warnf("Error stopping extra services: %v ", err)
-		return
+	// a stale cache may be missing what's been provisioned since, so start
+	// what it lists but don't stop anything on its say so
+	stale := staleCache()
+	if stale != nil {
+		r.error(stale)
 	}
 
-	if docker {
-		// Loop through our containers
-		// FIXME: Should split in parallel runners
-		if err := startMissingContainers(services); err != nil {
-			log.Warnf("Error starting missing containers: %v", err)
-			return
+	provisioned := services
+	levels.refresh(services)
+	services, suspended := levels.apply(services)
+
+	log.Debugf("Found %d services that should be running, %d suspended by run level", len(services), len(suspended))
+
+	// Every phase runs even if an earlier one failed, so that one broken
+	// service can't block the rest. Processes and containers are reconciled
+	// in parallel, sharing the workers.
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		// Loop through our processes
+		if err := startMissingProcesses(services, r); err != nil {
+			r.error(fmt.Errorf("Error starting missing services: %v", err))
 		}
 
-		if err := stopExtraContainers(services); err != nil {
-			log.Warnf("Error stopping extra services: %v", err)
+		if stale != nil {
 			return
 		}
+
+		if err := stopExtraProcesses(services, suspended, r); err != nil {
+			r.error(fmt.Errorf("Error stopping extra services: %v", err))
+		}
+	}()
+
+	if docker {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Loop through our containers
+			if err := startMissingContainers(services, r); err != nil {
+				r.error(fmt.Errorf("Error starting missing containers: %v", err))
+			}
+
+			if stale != nil {
+				return
+			}
+
+			if err := stopExtraContainers(services, suspended, r); err != nil {
+				r.error(fmt.Errorf("Error stopping extra containers: %v", err))
+			}
+		}()
 	}
+
+	wg.Wait()
+
+	// leave files alone while an operator may be using them
+	if r.maintenance == nil && stale == nil {
+		binaries.clean(provisioned)
+	}
+}
+
+// staleCache returns an error if the provisioned services were loaded from the
+// cache, because provisioning manager couldn't be reached, and were fetched
+// longer ago than hailo.service.provisioning.cache.maxAge in config
+func staleCache() error {
+	cache := dao.Cache()
+	if cache == nil || !cache.FromCache {
+		return nil
+	}
+
+	maxAge := config.AtPath("hailo", "service", "provisioning", "cache", "maxAge").AsDuration(defaultMaxCacheAge.String())
+	if maxAge <= 0 {
+		maxAge = defaultMaxCacheAge
+	}
+
+	if age := cache.Age(); age > maxAge {
+		return fmt.Errorf("Provisioned services are from a cache fetched from %s %v ago, not stopping services", cache.Source, age)
+	}
+	return nil
 }
 
 func splitLast(input string, char string) (string, string, error) {
@@ -118,6 +227,12 @@ func splitProcessName(processName string) (serviceName string, serviceVersion ui
 	return serviceName, serviceVersion, nil
 }
 
+// splitInstanceName splits a process name into service name, version and
+// instance index
+func splitInstanceName(processName string) (string, uint64, int, error) {
+	return process.SplitInstanceName(path.Base(processName))
+}
+
 func isDockerized() bool {
 	if _, err := exec.LookPath("docker"); err != nil {
 		return false
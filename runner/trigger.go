@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/HailoOSS/service/config"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	minPollInterval     = time.Second
+	// poll intervals vary by up to this fraction, so hosts don't all ask
+	// provisioning manager at once
+	pollJitter = 0.2
+	// how long to wait for more changes before checking
+	debounceDelay = time.Second
+)
+
+var (
+	// changes waiting for a check; one is enough to check
+	triggers = make(chan string, 1)
+)
+
+// Trigger asks for a check soon, because provisions of a machine class
+// changed. Changes to other classes are ignored. It returns whether a check
+// will follow.
+func Trigger(machineClass, reason string) bool {
+	if len(machineClass) > 0 && machineClass != myClass {
+		return false
+	}
+
+	select {
+	case triggers <- reason:
+	default:
+		// a check is already waiting
+	}
+	return true
+}
+
+// pollInterval is how often services are checked without being triggered,
+// read from config at hailo.service.provisioning.pollInterval so it can be
+// changed at runtime
+func pollInterval() time.Duration {
+	interval := config.AtPath("hailo", "service", "provisioning", "pollInterval").AsDuration(defaultPollInterval.String())
+	if interval <= 0 {
+		return defaultPollInterval
+	}
+	if interval < minPollInterval {
+		return minPollInterval
+	}
+	return interval
+}
+
+// jitter varies an interval by up to pollJitter either way
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*pollJitter*float64(d))
+}
+
+// debounce waits for changes to settle, so a burst of them leads to one
+// check
+func debounce(reason string) {
+	reasons := []string{reason}
+	timeout := time.After(debounceDelay)
+	for {
+		select {
+		case reason := <-triggers:
+			reasons = append(reasons, reason)
+		case <-timeout:
+			log.Infof("Checking services after changes: %s", strings.Join(reasons, "; "))
+			return
+		}
+	}
+}
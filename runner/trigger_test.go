@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrigger(t *testing.T) {
+	if Trigger("some-other-class", "changed") {
+		t.Error("Expected changes to another machine class to be ignored")
+	}
+
+	if !Trigger("", "first") || !Trigger(myClass, "second") {
+		t.Fatal("Expected changes to this machine class to trigger a check")
+	}
+
+	select {
+	case reason := <-triggers:
+		if reason != "first" {
+			t.Errorf("Expected the first change to be waiting, got %q", reason)
+		}
+	default:
+		t.Fatal("Expected a check to be waiting")
+	}
+
+	select {
+	case reason := <-triggers:
+		t.Errorf("Expected only one check to be waiting, got %q", reason)
+	default:
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(10 * time.Second); d < 8*time.Second || d > 12*time.Second {
+			t.Fatalf("Expected jitter within 20%%, got %v", d)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"fmt"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/event"
+)
+
+// holdUpgrade decides whether a running version which is no longer
+// provisioned must be kept because its replacement isn't running yet. The
+// replacement is started earlier in the same check, and only counts as
+// running once it has passed its readiness check, so the old version is
+// only stopped once the new one is up. A replacement which has failed before
+// must also stay up long enough to be trusted. Held stops are planned as
+// skipped.
+func (p *planner) holdUpgrade(t task, services dao.ProvisionedServices, replacementRunning func(*dao.ProvisionedService) bool) bool {
+	replacement := services.Replacement(t.name, t.version, t.typ)
+	if replacement == nil {
+		return false
+	}
+
+	failing := crashes.failing(replacement.ServiceName, replacement.ServiceVersion)
+	if !failing && replacementRunning(replacement) {
+		return false
+	}
+
+	p.skip(t, fmt.Sprintf("Keeping until version %d is running", replacement.ServiceVersion))
+
+	if failing && p.live && crashes.holdingUpgrade(replacement.ServiceName, replacement.ServiceVersion) {
+		msg := fmt.Sprintf("Version %d is failing, keeping version %d running", replacement.ServiceVersion, t.version)
+		log.Warnf("Service %s: %s", replacement.ServiceName, msg)
+		event.ProvisionError(replacement.ServiceName, replacement.ServiceVersion, msg)
+	}
+
+	return true
+}
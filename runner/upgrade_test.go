@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/HailoOSS/protobuf/proto"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/event"
+	pproto "github.com/HailoOSS/provisioning-service/proto"
+)
+
+// stubEvents stops events being published, returning the actions and
+// services of those which would have been, and a func to restore publishing
+func stubEvents() (*[]string, func()) {
+	var published []string
+	previous := event.SetPublisher(func(topic string, payload proto.Message) error {
+		if e, ok := payload.(*pproto.Event); ok {
+			published = append(published, fmt.Sprintf("%s %s-%d", e.GetAction(), e.GetServiceName(), e.GetServiceVersion()))
+		}
+		return nil
+	})
+	return &published, func() { event.SetPublisher(previous) }
+}
+
+func TestHoldUpgrade(t *testing.T) {
+	published, restore := stubEvents()
+	defer restore()
+
+	services := dao.ProvisionedServices{
+		{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 2},
+		{ServiceName: "com.HailoOSS.service.bar", ServiceVersion: 1},
+	}
+	old := task{action: actionStop, name: "com.HailoOSS.service.foo", version: 1}
+	notRunning := func(*dao.ProvisionedService) bool { return false }
+
+	p := newPlanner(true, nil)
+	if !p.holdUpgrade(old, services, notRunning) {
+		t.Error("Expected old version to be kept while the new one isn't running")
+	}
+	if len(p.tasks) != 1 || p.tasks[0].skip == "" {
+		t.Errorf("Expected the held upgrade to be planned as skipped, got %v", p.tasks)
+	}
+
+	crashes.started("com.HailoOSS.service.foo", 2, fmt.Errorf("download failed"))
+	if !newPlanner(true, nil).holdUpgrade(old, services, notRunning) {
+		t.Error("Expected old version to be kept when the new one failed to start")
+	}
+	if !newPlanner(true, nil).holdUpgrade(old, services, func(*dao.ProvisionedService) bool { return true }) {
+		t.Error("Expected old version to be kept until a new version which failed before is stable")
+	}
+	crashes.forget("com.HailoOSS.service.foo", 2)
+
+	if len(*published) != 1 || (*published)[0] != "ERROR PROVISIONING com.HailoOSS.service.foo-2" {
+		t.Errorf("Expected the failing version to be reported once, got %v", *published)
+	}
+
+	if newPlanner(true, nil).holdUpgrade(old, services, func(*dao.ProvisionedService) bool { return true }) {
+		t.Error("Expected old version to be stopped once the new one is running")
+	}
+
+	removed := task{action: actionStop, name: "com.HailoOSS.service.baz", version: 1}
+	if newPlanner(true, nil).holdUpgrade(removed, services, notRunning) {
+		t.Error("Expected a deprovisioned service without a new version to be stopped")
+	}
+}
@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/container"
+	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/process"
+)
+
+const (
+	// how often running processes and containers are listed, to notice
+	// services which crash between polls
+	watchInterval = 5 * time.Second
+)
+
+// watch checks services as soon as a process or container of a service
+// which should be running stops, so one which crashes is restarted straight
+// away rather than at the next poll
+func watch() {
+	var last map[string]dao.ServiceType
+	for {
+		time.Sleep(watchInterval)
+
+		running, err := listRunning()
+		if err != nil {
+			log.Debugf("Unable to list running services to watch: %v", err)
+			continue
+		}
+
+		if last != nil {
+			services, err := dao.CachedServices(myClass)
+			if err == nil {
+				services, _ = levels.apply(services)
+				if names := stoppedServices(last, running, services); len(names) > 0 {
+					Trigger("", strings.Join(names, ", ")+" stopped")
+				}
+			}
+		}
+		last = running
+	}
+}
+
+// listRunning returns the running processes and containers, and their type
+func listRunning() (map[string]dao.ServiceType, error) {
+	running := make(map[string]dao.ServiceType)
+
+	processes, err := process.ListRunning("com.HailoOSS")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range processes {
+		running[name] = dao.ServiceTypeProcess
+	}
+
+	if docker {
+		containers, err := container.ListRunning("com.HailoOSS")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range containers {
+			running[name] = dao.ServiceTypeContainer
+		}
+	}
+
+	return running, nil
+}
+
+// stoppedServices returns the processes and containers which were running
+// before but aren't now, of services which should be running. Those we
+// stopped because they're no longer provisioned, or are suspended, are
+// ignored.
+func stoppedServices(before, now map[string]dao.ServiceType, services dao.ProvisionedServices) []string {
+	var names []string
+	for name, typ := range before {
+		if _, ok := now[name]; ok {
+			continue
+		}
+
+		var serviceName string
+		var serviceVersion uint64
+		var err error
+		if typ == dao.ServiceTypeContainer {
+			serviceName, serviceVersion, err = splitProcessName(name)
+		} else {
+			serviceName, serviceVersion, _, err = process.SplitInstanceName(path.Base(name))
+		}
+		if err != nil {
+			continue
+		}
+
+		if services.Contains(serviceName, serviceVersion, typ) {
+			names = append(names, path.Base(name))
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
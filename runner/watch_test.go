@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+func TestStoppedServices(t *testing.T) {
+	services := dao.ProvisionedServices{
+		{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 2, ServiceType: dao.ServiceTypeProcess},
+		{ServiceName: "com.HailoOSS.service.bar", ServiceVersion: 1, ServiceType: dao.ServiceTypeContainer},
+	}
+
+	before := map[string]dao.ServiceType{
+		"com.HailoOSS.service.foo-2@0": dao.ServiceTypeProcess,
+		"com.HailoOSS.service.foo-2@1": dao.ServiceTypeProcess,
+		"com.HailoOSS.service.foo-1@0": dao.ServiceTypeProcess,
+		"com.HailoOSS.service.bar-1":   dao.ServiceTypeContainer,
+	}
+	now := map[string]dao.ServiceType{
+		"com.HailoOSS.service.foo-2@0": dao.ServiceTypeProcess,
+	}
+
+	// foo-1 isn't provisioned, so was stopped on purpose
+	expected := []string{"com.HailoOSS.service.bar-1", "com.HailoOSS.service.foo-2@1"}
+	if names := stoppedServices(before, now, services); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v to have stopped, got %v", expected, names)
+	}
+
+	if names := stoppedServices(now, now, services); len(names) != 0 {
+		t.Errorf("Expected nothing to have stopped, got %v", names)
+	}
+}
@@ -0,0 +1,138 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/goamz/goamz/s3"
+)
+
+// key returns the S3 key for a file, or nil if it does not exist
+func (s *S3Mgr) key(bucketName, remotePath string) (*s3.Key, error) {
+	bucket, err := s.bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	name := bucket.path(remotePath)
+	res, err := bucket.List(name, "", "", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Contents) == 1 && res.Contents[0].Key == name {
+		return &res.Contents[0], nil
+	}
+
+	return nil, nil
+}
+
+// download fetches a file into partPath, resuming from the end of partPath
+// with a range request if it already exists
+func (s *S3Mgr) download(bucketName, remotePath, partPath string, size int64) error {
+	bucket, err := s.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	fh, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	offset, done, err := resumeOffset(fh, size)
+	if err != nil || done {
+		return err
+	}
+
+	headers := make(map[string][]string)
+	if offset > 0 {
+		headers["Range"] = []string{fmt.Sprintf("bytes=%d-", offset)}
+	}
+
+	resp, err := bucket.GetResponseWithHeaders(bucket.path(remotePath), headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		// the range was ignored, so we're getting the whole file
+		if _, err := resetPartial(fh); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.Copy(fh, resp.Body); err != nil {
+		return err
+	}
+
+	return fh.Sync()
+}
+
+// resumeOffset returns where to resume a partial download of a file of size
+// bytes from, and whether it is already complete. A partial download longer
+// than the file is started again.
+func resumeOffset(fh *os.File, size int64) (int64, bool, error) {
+	offset, err := fh.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch {
+	case offset == size:
+		return offset, true, nil
+	case offset > size:
+		// can't be a partial download of this file
+		offset, err = resetPartial(fh)
+		return offset, false, err
+	}
+
+	return offset, false, nil
+}
+
+// resetPartial truncates a partial download so it starts again from the beginning
+func resetPartial(fh *os.File) (int64, error) {
+	if err := fh.Truncate(0); err != nil {
+		return 0, err
+	}
+
+	return fh.Seek(0, io.SeekStart)
+}
+
+// verifyDownload checks a completed download against its S3 key. The ETag is
+// only an md5 of the content for objects which were not multipart uploads.
+func verifyDownload(name string, key *s3.Key) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+
+	if n != key.Size {
+		return fmt.Errorf("Downloaded %d bytes of %s, expected %d", n, key.Key, key.Size)
+	}
+
+	etag := strings.Trim(key.ETag, `"`)
+	if len(etag) != md5.Size*2 {
+		return nil
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, etag) {
+		return fmt.Errorf("Downloaded %s has md5 %s, expected %s", key.Key, sum, etag)
+	}
+
+	return nil
+}
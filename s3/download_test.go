@@ -0,0 +1,113 @@
+package s3
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goamz/goamz/s3"
+)
+
+func writePartial(t *testing.T, dir, content string) *os.File {
+	name := filepath.Join(dir, "partial")
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fh, err := os.OpenFile(name, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fh
+}
+
+func TestResumeOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		partial string
+		size    int64
+		offset  int64
+		done    bool
+	}{
+		{"", 5, 0, false},
+		{"abc", 5, 3, false},
+		{"abcde", 5, 5, true},
+		// longer than the file, so starts again
+		{"abcdef", 5, 0, false},
+	}
+
+	for _, tc := range testCases {
+		fh := writePartial(t, dir, tc.partial)
+		offset, done, err := resumeOffset(fh, tc.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != tc.offset || done != tc.done {
+			t.Errorf("Expected %q of %d bytes to resume at %d (done %v), got %d (done %v)", tc.partial, tc.size, tc.offset, tc.done, offset, done)
+		}
+
+		// the file is written from the offset
+		if fi, _ := fh.Stat(); fi.Size() != tc.offset {
+			t.Errorf("Expected %q to be %d bytes long, got %d", tc.partial, tc.offset, fi.Size())
+		}
+		fh.Close()
+	}
+}
+
+func TestResetPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fh := writePartial(t, dir, "abc")
+	defer fh.Close()
+
+	offset, err := resetPartial(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := fh.Stat(); offset != 0 || fi.Size() != 0 {
+		t.Errorf("Expected an empty file written from the start, got %d bytes at %d", fi.Size(), offset)
+	}
+}
+
+func TestVerifyDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "binary")
+	if err := ioutil.WriteFile(name, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		key   s3.Key
+		valid bool
+	}{
+		// md5 of "hello"
+		{s3.Key{Key: "binary", Size: 5, ETag: `"5d41402abc4b2a76b9719d911017c592"`}, true},
+		{s3.Key{Key: "binary", Size: 5, ETag: `"5D41402ABC4B2A76B9719D911017C592"`}, true},
+		{s3.Key{Key: "binary", Size: 5, ETag: `"00000000000000000000000000000000"`}, false},
+		{s3.Key{Key: "binary", Size: 6, ETag: `"5d41402abc4b2a76b9719d911017c592"`}, false},
+		// multipart uploads don't have an md5 ETag, so only the size is checked
+		{s3.Key{Key: "binary", Size: 5, ETag: `"00000000000000000000000000000000-2"`}, true},
+	}
+
+	for _, tc := range testCases {
+		key := tc.key
+		if err := verifyDownload(name, &key); (err == nil) != tc.valid {
+			t.Errorf("Expected %+v valid %v, got %v", tc.key, tc.valid, err)
+		}
+	}
+}
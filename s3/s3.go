@@ -1,16 +1,14 @@
 package s3
 
 import (
-	"bufio"
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	log "github.com/cihub/seelog"
 	"github.com/goamz/goamz/aws"
 	"github.com/goamz/goamz/s3"
 	"github.com/HailoOSS/provisioning-service/dao"
+	"github.com/HailoOSS/provisioning-service/fsutil"
 	"github.com/HailoOSS/provisioning-service/process"
-	"io"
+	"github.com/HailoOSS/provisioning-service/verify"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,8 +16,10 @@ import (
 )
 
 const (
-	buildsBucket   = "hailo-builds"
-	requestTimeout = time.Minute
+	buildsBucket     = "hailo-builds"
+	requestTimeout   = time.Minute
+	downloadAttempts = 5
+	downloadBackoff  = time.Second
 )
 
 var (
@@ -63,15 +63,6 @@ func newS3Conn(regionPrefix string) *s3.S3 {
 	return s3c
 }
 
-func s3Path(ps *dao.ProvisionedService) string {
-	return fmt.Sprintf(
-		"%v/%v-%v",
-		strings.Replace(ps.ServiceName, ".", "/", -1),
-		ps.ServiceName,
-		ps.ServiceVersion,
-	)
-}
-
 func New() *S3Mgr {
 	return &S3Mgr{
 		buckets: make(map[string]*s3Bucket),
@@ -145,12 +136,15 @@ func (s *S3Mgr) Setup() error {
 // and store within the local filesystem, returning the full path to the
 // new file
 func (s *S3Mgr) Download(ps *dao.ProvisionedService) (string, error) {
-	return s.DownloadFile(buildsBucket, s3Path(ps), process.ExePath(ps))
+	return s.DownloadFile(buildsBucket, fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion), process.ExePath(ps))
 }
 
-// DownloadFile retrieves a file from S3
+// DownloadFile retrieves a file from S3. It is downloaded to a partial file
+// alongside localPath, resuming any earlier attempt, and only renamed into
+// place once complete and verified, so localPath is never left half written.
 func (s *S3Mgr) DownloadFile(bucketName, remotePath, localPath string) (string, error) {
-	if ok, err := s.FileExists(bucketName, remotePath); !ok {
+	key, err := s.key(bucketName, remotePath)
+	if err != nil || key == nil {
 		return localPath, fmt.Errorf("File does not exist in S3: %v, %v", remotePath, err)
 	}
 
@@ -160,28 +154,29 @@ func (s *S3Mgr) DownloadFile(bucketName, remotePath, localPath string) (string,
 		return localPath, err
 	}
 
-	fh, err := os.Create(localPath)
-	if err != nil {
-		return localPath, err
-	}
-
-	defer fh.Close()
+	partPath := localPath + fsutil.PartialExtension
+	backoff := downloadBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.download(bucketName, remotePath, partPath, key.Size)
+		if err == nil {
+			break
+		}
 
-	bucket, err := s.bucket(bucketName)
-	if err != nil {
-		return localPath, err
-	}
+		if attempt == downloadAttempts {
+			return localPath, fmt.Errorf("Failed to download %v after %d attempts: %v", remotePath, attempt, err)
+		}
 
-	bckR, err := bucket.GetReader(bucket.path(remotePath))
-	if err != nil {
-		return localPath, err
+		log.Warnf("Failed to download %v (attempt %d of %d), retrying in %v: %v", remotePath, attempt, downloadAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 
-	if _, err := io.Copy(fh, bckR); err != nil {
+	if err := verifyDownload(partPath, key); err != nil {
+		os.Remove(partPath)
 		return localPath, err
 	}
 
-	if err := os.Chmod(localPath, 0755); err != nil {
+	if err := fsutil.FinishDownload(localPath); err != nil {
 		return localPath, err
 	}
 
@@ -191,27 +186,18 @@ func (s *S3Mgr) DownloadFile(bucketName, remotePath, localPath string) (string,
 // Exists will check if this provisioned service exists on S3 (this is our
 // test of whether it is a valid provisioned service)
 func (s *S3Mgr) Exists(ps *dao.ProvisionedService) (bool, error) {
-	// using a prefix of our entire name as we expect
-	return s.FileExists(buildsBucket, s3Path(ps))
+	return s.FileExists(buildsBucket, fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion))
 }
 
-// FileExists checks whether a file exists in S3
+// FileExists checks whether a file exists in S3. Only the exact key counts,
+// not others it is a prefix of.
 func (s *S3Mgr) FileExists(bucketName, remotePath string) (bool, error) {
-	bucket, err := s.bucket(bucketName)
+	key, err := s.key(bucketName, remotePath)
 	if err != nil {
 		return false, err
 	}
 
-	res, err := bucket.List(bucket.path(remotePath), "", "", 1)
-	if err != nil {
-		return false, err
-	}
-
-	if len(res.Contents) == 1 {
-		return true, nil
-	}
-
-	return false, nil
+	return key != nil, nil
 }
 
 // IsDownloaded will check if we have already downloaded this binary/JAR to
@@ -235,59 +221,38 @@ func (s *S3Mgr) Delete(ps *dao.ProvisionedService) error {
 	return nil
 }
 
-// VerifyBinary downloads the md5sum for a binary if it exists and checks it against the
-// downloaded binary. If the md5sum file does not exist
+// VerifyBinary fetches the signed manifest for a binary if it exists and
+// checks the signature and sha256 against the downloaded binary
 func (s *S3Mgr) VerifyBinary(ps *dao.ProvisionedService) error {
-	binary := process.ExePath(ps)
-	remoteMD5 := fmt.Sprintf("%s.md5", s3Path(ps))
-	localMD5 := fmt.Sprintf("%s.md5", binary)
-
-	// If the md5 file does not exist just return
-	if ok, _ := s.FileExists(buildsBucket, remoteMD5); !ok {
-		log.Warnf("Missing remote md5 for %s... ignoring", binary)
-		return nil
-	}
-
-	// Attempt to download the md5 file
-	if _, err := s.DownloadFile(buildsBucket, remoteMD5, localMD5); err != nil {
-		return err
-	}
-
-	// Get the md5 from the file
-	f, err := os.Open(localMD5)
-	defer f.Close()
+	manifest, err := s.getFile(buildsBucket, verify.ManifestPath(fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion)))
 	if err != nil {
 		return err
 	}
-	r := bufio.NewReader(f)
-	str, err := r.ReadString('\n')
+
+	signature, err := s.getFile(buildsBucket, verify.SignaturePath(fsutil.BuildPath(ps.ServiceName, ps.ServiceVersion)))
 	if err != nil {
 		return err
 	}
 
-	// The remote md5
-	rmd5 := strings.TrimRight(str, "\n")
+	return verify.Binary(ps, process.ExePath(ps), manifest, signature)
+}
 
-	// Get the md5 from the binary
-	f2, err := os.Open(binary)
-	defer f2.Close()
+// getFile reads a small file from S3, returning nil if it does not exist.
+// Failing to find out whether it exists is an error, so that a missing
+// manifest can't be mistaken for an unsigned binary.
+func (s *S3Mgr) getFile(bucketName, remotePath string) ([]byte, error) {
+	ok, err := s.FileExists(bucketName, remotePath)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("Unable to check for %s in S3: %v", remotePath, err)
 	}
-
-	h := md5.New()
-	_, err = io.Copy(h, f2)
-	if err != nil {
-		return err
+	if !ok {
+		return nil, nil
 	}
 
-	// The binary md5
-	bmd5 := hex.EncodeToString(h.Sum(nil))
-
-	if rmd5 != bmd5 {
-		return fmt.Errorf("Failed to verify md5 for %s. Binary %s, remote md5 file %s", binary, bmd5, rmd5)
+	bucket, err := s.bucket(bucketName)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Debugf("Verified md5 for %s. Binary %s, remote md5 file %s", binary, bmd5, rmd5)
-	return nil
+	return bucket.Get(bucket.path(remotePath))
 }
@@ -0,0 +1,172 @@
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+const (
+	manifestExtension  = ".manifest"
+	signatureExtension = ".manifest.sig"
+	defaultKeysDir     = "/opt/hailo/etc/trusted-keys"
+)
+
+var (
+	keysDir       = os.Getenv("HAILO_TRUSTED_KEYS_DIR")
+	requireSigned bool
+)
+
+// Manifest is published alongside each build, and signed with ed25519
+type Manifest struct {
+	ServiceName    string `json:"serviceName"`
+	ServiceVersion uint64 `json:"serviceVersion"`
+	SHA256         string `json:"sha256"`
+}
+
+func init() {
+	if len(keysDir) == 0 {
+		keysDir = defaultKeysDir
+	}
+
+	requireSigned, _ = strconv.ParseBool(os.Getenv("HAILO_REQUIRE_SIGNED_BINARIES"))
+}
+
+// ManifestPath returns the path of the manifest for a build
+func ManifestPath(buildPath string) string {
+	return buildPath + manifestExtension
+}
+
+// SignaturePath returns the path of the detached manifest signature for a build
+func SignaturePath(buildPath string) string {
+	return buildPath + signatureExtension
+}
+
+// trustedKeys loads the ed25519 public keys from the trusted keys directory,
+// one base64 encoded key per file
+func trustedKeys() ([]ed25519.PublicKey, error) {
+	files, err := ioutil.ReadDir(keysDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []ed25519.PublicKey
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(keysDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			log.Warnf("Ignoring invalid trusted key %s", file.Name())
+			continue
+		}
+
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+
+	return keys, nil
+}
+
+// verifySignature checks the manifest was signed by one of our trusted keys
+func verifySignature(manifest, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("Invalid manifest signature: %v", err)
+	}
+
+	keys, err := trustedKeys()
+	if err != nil {
+		return fmt.Errorf("Unable to load trusted keys: %v", err)
+	}
+
+	for _, key := range keys {
+		if ed25519.Verify(key, manifest, sig) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Manifest signature does not match any of %d trusted keys", len(keys))
+}
+
+// sha256File returns the hex encoded sha256 of a file
+func sha256File(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Unsigned handles a binary which has no manifest, refusing it if signed
+// binaries are required
+func Unsigned(binary string) error {
+	if requireSigned {
+		return fmt.Errorf("Refusing unsigned binary %s", binary)
+	}
+
+	log.Warnf("Missing signed manifest for %s... ignoring", binary)
+	return nil
+}
+
+// Binary checks the manifest signature and that the binary matches the
+// manifest. A nil manifest or signature means none was published.
+func Binary(ps *dao.ProvisionedService, binary string, manifest, signature []byte) error {
+	if manifest == nil {
+		return Unsigned(binary)
+	}
+
+	if signature != nil {
+		if err := verifySignature(manifest, signature); err != nil {
+			return fmt.Errorf("Failed to verify manifest for %s: %v", binary, err)
+		}
+	} else if err := Unsigned(binary); err != nil {
+		return err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(manifest, m); err != nil {
+		return fmt.Errorf("Invalid manifest for %s: %v", binary, err)
+	}
+
+	if m.ServiceName != ps.ServiceName || m.ServiceVersion != ps.ServiceVersion {
+		return fmt.Errorf("Manifest for %s is for %s-%d", binary, m.ServiceName, m.ServiceVersion)
+	}
+
+	digest, err := sha256File(binary)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(m.SHA256, digest) {
+		return fmt.Errorf("Failed to verify sha256 for %s. Binary %s, manifest %s", binary, digest, m.SHA256)
+	}
+
+	log.Debugf("Verified sha256 for %s. Binary %s, manifest %s", binary, digest, m.SHA256)
+	return nil
+}
@@ -0,0 +1,90 @@
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HailoOSS/provisioning-service/dao"
+)
+
+func TestBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keysDir = filepath.Join(dir, "keys")
+	os.MkdirAll(keysDir, 0755)
+	if err := ioutil.WriteFile(filepath.Join(keysDir, "build.pub"), []byte(base64.StdEncoding.EncodeToString(pub)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	contents := []byte("#!/bin/sh\necho hello")
+	binary := filepath.Join(dir, "com.HailoOSS.service.foo-20130618183200")
+	if err := ioutil.WriteFile(binary, contents, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256(contents)
+	manifest, _ := json.Marshal(&Manifest{
+		ServiceName:    "com.HailoOSS.service.foo",
+		ServiceVersion: 20130618183200,
+		SHA256:         hex.EncodeToString(digest[:]),
+	})
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, manifest)))
+
+	ps := &dao.ProvisionedService{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 20130618183200}
+	other := &dao.ProvisionedService{ServiceName: "com.HailoOSS.service.foo", ServiceVersion: 20130618183201}
+
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	badSignature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(otherPriv, manifest)))
+
+	testCases := []struct {
+		desc          string
+		ps            *dao.ProvisionedService
+		manifest      []byte
+		signature     []byte
+		requireSigned bool
+		valid         bool
+	}{
+		{"signed", ps, manifest, signature, true, true},
+		{"untrusted key", ps, manifest, badSignature, false, false},
+		{"wrong version", other, manifest, signature, false, false},
+		{"unsigned manifest", ps, manifest, nil, false, true},
+		{"unsigned manifest required", ps, manifest, nil, true, false},
+		{"no manifest", ps, nil, nil, false, true},
+		{"no manifest required", ps, nil, nil, true, false},
+	}
+
+	for _, tc := range testCases {
+		requireSigned = tc.requireSigned
+		err := Binary(tc.ps, binary, tc.manifest, tc.signature)
+		if tc.valid && err != nil {
+			t.Errorf("%s: expected binary to verify, got %v", tc.desc, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected binary to fail verification", tc.desc)
+		}
+	}
+
+	// tamper with the binary
+	requireSigned = true
+	ioutil.WriteFile(binary, []byte("#!/bin/sh\necho pwned"), 0755)
+	if err := Binary(ps, binary, manifest, signature); err == nil {
+		t.Error("Expected tampered binary to fail verification")
+	}
+}